@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"monkebot/config"
+	"monkebot/database"
+	"os"
+)
+
+const backupUsage = "usage: monkebot [flags] backup snapshot <path>|export <path>|import <path>"
+
+// runs the backup subcommand, which saves or restores the bot's data without starting it
+func runBackup(cfg config.Config, args []string, out io.Writer) error {
+	if len(args) != 2 {
+		return errors.New(backupUsage)
+	}
+	path := args[1]
+
+	dialect, err := database.DialectFor(cfg.DBConfig.Driver)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "snapshot":
+		db, err := database.OpenDB(cfg.DBConfig.Driver, cfg.DBConfig.DataSourceName)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		err = database.Snapshot(db, dialect, path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "saved snapshot to %s\n", path)
+		return nil
+	case "export":
+		return exportData(cfg, path, out)
+	case "import":
+		return importData(cfg, path, out)
+	}
+
+	return fmt.Errorf("unknown backup command '%s', %s", args[0], backupUsage)
+}
+
+func exportData(cfg config.Config, path string, out io.Writer) error {
+	db, err := database.OpenDB(cfg.DBConfig.Driver, cfg.DBConfig.DataSourceName)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	data, err := database.ExportData(tx)
+	if err != nil {
+		return err
+	}
+
+	exported, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode exported data: %w", err)
+	}
+
+	// O_EXCL so an export never overwrites an older one
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create export file: %w", err)
+	}
+	defer file.Close()
+
+	_, err = file.Write(exported)
+	if err != nil {
+		return fmt.Errorf("failed to write export file: %w", err)
+	}
+
+	fmt.Fprintf(out, "exported %d users to %s\n", len(data.Users), path)
+	return file.Close()
+}
+
+// the database is migrated first, so data can be imported into a new database
+func importData(cfg config.Config, path string, out io.Writer) error {
+	exported, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read export file: %w", err)
+	}
+
+	var data database.BotData
+	err = json.Unmarshal(exported, &data)
+	if err != nil {
+		return fmt.Errorf("failed to decode export file: %w", err)
+	}
+
+	db, err := database.InitDB(cfg.DBConfig.Driver, cfg.DBConfig.DataSourceName, cfg.DBConfig.Version)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	err = database.ImportData(tx, &data)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("failed to commit imported data: %w", err)
+	}
+
+	fmt.Fprintf(out, "imported %d users from %s\n", len(data.Users), path)
+	return nil
+}
@@ -4,7 +4,9 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type argType int
@@ -12,137 +14,392 @@ type argType int
 const (
 	positional argType = iota
 	named
+	rest
 )
 
-var (
-	ErrInvalidArgLength = errors.New("invalid arg length")
-	ErrInvalidArgType   = errors.New("invalid arg type")
-	ErrNoMatchingSpec   = errors.New("no spec matches args")
-)
+var ErrNoMatchingSpec = errors.New("no spec matches args")
+
+// TwitchUser is a username arg, without the @ of mentions and in lowercase like twitch logins
+type TwitchUser string
+
+// ArgError is returned when an arg has the right position or name for a field, but its value can't be parsed
+type ArgError struct {
+	Field string
+	Value string
+	// what the value should be, like "a whole number"
+	Expected string
+}
 
-type cmdArg struct {
-	Name     string
-	Value    string
-	Type     argType
-	ArgIndex int // intended index for this arg in the args list(for positional args)
+func (e *ArgError) Error() string {
+	return fmt.Sprintf("invalid %s '%s', expected %s", e.Field, e.Value, e.Expected)
 }
 
-func parseArgs(msg string) *map[string]cmdArg {
-	args := strings.Split(strings.TrimSpace(msg), " ")
-	if len(args) <= 1 {
+// arguments of a message, without the command name
+type cmdArgs struct {
+	// the message as written and its args in order
+	raw    string
+	tokens []argToken
+}
+
+// Returns nil if the message has no arguments.
+// Double quotes group words into a single arg, like "some words" or name:"some words".
+func parseArgs(msg string) *cmdArgs {
+	tokens := splitArgs(msg)
+	if len(tokens) <= 1 {
 		return nil
 	}
+	return &cmdArgs{raw: msg, tokens: tokens[1:]}
+}
 
-	cmdArgs := make([]cmdArg, len(args)-1)
+type argToken struct {
+	name, value string
+	isNamed     bool   // has a colon outside of quotes, it's only a named arg if the spec has a field with its name
+	text        string // the whole arg without quotes, used when it isn't a named arg
+	start       int    // byte offset of the token in the message
+}
 
-	for i, arg := range args[1:] {
-		before, after, found := strings.Cut(arg, ":")
-		if found {
-			cmdArgs[i] = cmdArg{Name: before, Value: after, Type: named}
+// Returns whether the token is a named arg of a spec with the named fields
+func (t argToken) isNamedIn(namedFields map[string]bool) bool {
+	return t.isNamed && namedFields[strings.ToLower(t.name)]
+}
+
+// Returns the positional and named args of a spec with the named fields, names are lowercase.
+// Args like 12:30, https://... or D: are positional unless the spec has a named field called 12, https or D.
+func (a *cmdArgs) forSpec(namedFields map[string]bool) ([]string, map[string]string) {
+	var (
+		positional []string
+		named      = make(map[string]string)
+	)
+	for _, token := range a.tokens {
+		if token.isNamedIn(namedFields) {
+			named[strings.ToLower(token.name)] = token.value
 		} else {
-			cmdArgs[i] = cmdArg{Name: arg, Value: arg, Type: positional, ArgIndex: i}
+			positional = append(positional, token.text)
 		}
 	}
+	return positional, named
+}
 
-	nameToCmdArg := make(map[string]cmdArg, len(cmdArgs))
-	for _, arg := range cmdArgs {
-		nameToCmdArg[arg.Name] = arg
+// Splits msg on whitespace outside of double quotes, an unterminated quote takes the rest of the message.
+// The first colon outside of quotes marks a possible named arg.
+func splitArgs(msg string) []argToken {
+	var (
+		tokens  []argToken
+		current argToken
+		value   strings.Builder
+		text    strings.Builder
+		inQuote bool
+		inToken bool
+	)
+	for i, r := range msg {
+		switch {
+		case r == '"':
+			if !inToken {
+				current.start = i
+			}
+			inQuote = !inQuote
+			inToken = true
+		case inQuote:
+			value.WriteRune(r)
+			text.WriteRune(r)
+		case r == ' ' || r == '\t' || r == '\n':
+			if inToken {
+				current.value, current.text = value.String(), text.String()
+				tokens = append(tokens, current)
+			}
+			current, inToken = argToken{}, false
+			value.Reset()
+			text.Reset()
+		case r == ':' && !current.isNamed && value.Len() > 0:
+			current.name, current.isNamed = value.String(), true
+			value.Reset()
+			text.WriteRune(r)
+		default:
+			if !inToken {
+				current.start = i
+			}
+			value.WriteRune(r)
+			text.WriteRune(r)
+			inToken = true
+		}
+	}
+	if inToken {
+		current.value, current.text = value.String(), text.String()
+		tokens = append(tokens, current)
 	}
-	return &nameToCmdArg
+	return tokens
 }
 
-func getFirstMatchingArgSpec(nameToCmdArg *map[string]cmdArg, argSpecs ...interface{}) (result interface{}, err error) {
-	var hasValidFieldCount bool
+// Returns a new copy of the first argSpec matched by args, with its fields filled.
+// Positional fields are filled in order, a slice field takes all remaining positional args, so it must be the last one.
+// Named fields match args named after the field in lowercase, args with a colon that don't name a field are positional.
+// A rest field is a string with the rest of the message as written, after the positional args before it, without
+// parsing quotes or named args, so it must be the last field.
+// Args that don't have a field, or missing required fields, mean the spec doesn't match.
+// Missing fields that aren't required are set to their default:"value" tag.
+// If no spec matches and a value couldn't be parsed, the first *ArgError is returned instead of ErrNoMatchingSpec.
+//
+// Fields can be strings, ints, float64, bool, time.Duration, TwitchUser or a slice of those.
+func getFirstMatchingArgSpec(args *cmdArgs, argSpecs ...interface{}) (interface{}, error) {
+	if args == nil {
+		args = &cmdArgs{}
+	}
+
+	var firstArgErr *ArgError
 	for _, argSpec := range argSpecs {
-		t := reflect.TypeOf(argSpec)
-		nFields := 0
-		for i := 0; i < t.NumField(); i++ {
-			field := t.Field(i)
-			if field.IsExported() {
-				nFields++
+		result, err := fillArgSpec(args, argSpec)
+		var argErr *ArgError
+		if errors.As(err, &argErr) {
+			if firstArgErr == nil {
+				firstArgErr = argErr
 			}
+			continue
 		}
-		if t.NumField() == len(*nameToCmdArg) {
-			hasValidFieldCount = true
-			break
+		if err != nil {
+			return nil, err
+		}
+		if result != nil {
+			return result, nil
 		}
 	}
 
-	if !hasValidFieldCount {
-		err = ErrInvalidArgLength
-		return
+	if firstArgErr != nil {
+		return nil, firstArgErr
 	}
+	return nil, ErrNoMatchingSpec
+}
 
-	for _, argSpec := range argSpecs {
-		t := reflect.TypeOf(argSpec)
-		if t.Kind() != reflect.Ptr {
-			err = fmt.Errorf("%s is not a pointer", t)
-			return
+// Returns nil if the args don't match argSpec, an *ArgError for invalid values and other errors if argSpec itself is invalid
+func fillArgSpec(args *cmdArgs, argSpec interface{}) (interface{}, error) {
+	t := reflect.TypeOf(argSpec)
+	if t.Kind() != reflect.Ptr {
+		return nil, fmt.Errorf("%s is not a pointer", t)
+	}
+
+	t = t.Elem()
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%s is not a struct", t)
+	}
+
+	namedFields := make(map[string]bool)
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).Tag.Get("argtype") == "named" {
+			namedFields[strings.ToLower(t.Field(i).Name)] = true
 		}
+	}
+	positionalArgs, namedArgs := args.forSpec(namedFields)
 
-		t = t.Elem()
-		if t.Kind() != reflect.Struct {
-			err = fmt.Errorf("%s is not a struct", t)
-			return
+	var (
+		spec      = reflect.New(t).Elem()
+		matches   = true // false if a required field is missing
+		argErr    *ArgError
+		nextPos   int // index of the next positional arg
+		usedNamed = make(map[string]bool)
+	)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
 		}
 
-		validFields := 0
-		totalFields := t.NumField()
-		for i := 0; i < t.NumField(); i++ {
-			field := t.Field(i)
-			if !field.IsExported() {
-				totalFields--
-				continue
-			}
+		fieldArgType, fieldRequired, err := parseArgTags(field)
+		if err != nil {
+			return nil, err
+		}
 
-			var (
-				required     bool
-				fieldArgType = positional
-			)
-
-			switch field.Tag.Get("argtype") {
-			case "named":
-				fieldArgType = named
-			case "positional":
-				fieldArgType = positional
-			default:
-				err = fmt.Errorf("invalid argtype, must be 'named' or 'positional': %s", field.Tag.Get("argtype"))
-				return
+		var values []string
+		switch {
+		case fieldArgType == named:
+			if field.Type.Kind() == reflect.Slice {
+				return nil, fmt.Errorf("named arg %s can't be a slice", field.Name)
 			}
-
-			switch field.Tag.Get("required") {
-			case "true":
-				required = true
-			case "false":
-				required = false
-			default:
-				err = fmt.Errorf("invalid required value, must be 'true' or 'false': %s", field.Tag.Get("required"))
-				return
+			if value, found := namedArgs[strings.ToLower(field.Name)]; found {
+				values = []string{value}
+				usedNamed[strings.ToLower(field.Name)] = true
+			}
+		case fieldArgType == rest:
+			if field.Type.Kind() != reflect.String {
+				return nil, fmt.Errorf("rest arg %s must be a string", field.Name)
 			}
+			if value, found := args.rest(nextPos, namedFields, usedNamed); found {
+				values = []string{value}
+				nextPos = len(positionalArgs)
+			}
+		case field.Type.Kind() == reflect.Slice:
+			values = positionalArgs[min(nextPos, len(positionalArgs)):]
+			nextPos = len(positionalArgs)
+		case nextPos < len(positionalArgs):
+			values = []string{positionalArgs[nextPos]}
+			nextPos++
+		}
 
-			if !required {
-				validFields++
+		if len(values) == 0 {
+			matches = matches && !fieldRequired
+			defaultValue, hasDefault := field.Tag.Lookup("default")
+			if !hasDefault {
 				continue
 			}
+			values = []string{defaultValue}
+			if field.Type.Kind() == reflect.Slice {
+				values = strings.Fields(defaultValue)
+			}
+			err = setArgField(spec.Field(i), field.Name, values)
+			if err != nil {
+				// %v, so it isn't mistaken for an invalid arg from the user
+				return nil, fmt.Errorf("invalid default for arg %s: %v", field.Name, err)
+			}
+			continue
+		}
+
+		err = setArgField(spec.Field(i), field.Name, values)
+		var fieldErr *ArgError
+		if errors.As(err, &fieldErr) {
+			if argErr == nil {
+				argErr = fieldErr
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// args left over mean the user meant another spec
+	if !matches || nextPos < len(positionalArgs) || len(usedNamed) < len(namedArgs) {
+		return nil, nil
+	}
+	if argErr != nil {
+		return nil, argErr
+	}
+	return spec.Addr().Interface(), nil
+}
 
-			cmdArg, found := (*nameToCmdArg)[strings.ToLower(field.Name)]
-			if !found {
-				break
+// Returns the message as written from the arg after the first skipPositional positional args,
+// adding the named args it includes to usedNamed
+func (a *cmdArgs) rest(skipPositional int, namedFields map[string]bool, usedNamed map[string]bool) (string, bool) {
+	for i, token := range a.tokens {
+		if skipPositional > 0 {
+			if !token.isNamedIn(namedFields) {
+				skipPositional--
 			}
+			continue
+		}
 
-			if cmdArg.Type != fieldArgType {
-				break
+		for _, included := range a.tokens[i:] {
+			if included.isNamedIn(namedFields) {
+				usedNamed[strings.ToLower(included.name)] = true
 			}
+		}
+		return strings.TrimSpace(a.raw[token.start:]), true
+	}
+	return "", false
+}
+
+var (
+	durationType   = reflect.TypeOf(time.Duration(0))
+	twitchUserType = reflect.TypeOf(TwitchUser(""))
+)
+
+// Sets field to the parsed values, a field that isn't a slice gets the first value
+func setArgField(field reflect.Value, name string, values []string) error {
+	if field.Kind() != reflect.Slice {
+		return setArgValue(field, name, values[0])
+	}
+
+	slice := reflect.MakeSlice(field.Type(), len(values), len(values))
+	for i, value := range values {
+		err := setArgValue(slice.Index(i), name, value)
+		if err != nil {
+			return err
+		}
+	}
+	field.Set(slice)
+	return nil
+}
 
-			validFields++
+func setArgValue(field reflect.Value, name string, value string) error {
+	argErr := func(expected string) error {
+		return &ArgError{Field: strings.ToLower(name), Value: value, Expected: expected}
+	}
+
+	switch field.Type() {
+	case durationType:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return argErr("a duration like 10m or 1h30m")
+		}
+		field.SetInt(int64(d))
+		return nil
+	case twitchUserType:
+		user := strings.ToLower(strings.TrimPrefix(value, "@"))
+		if user == "" {
+			return argErr("a username")
 		}
+		field.SetString(user)
+		return nil
+	}
 
-		if validFields == totalFields {
-			result = argSpec
-			return
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil {
+			return argErr("a whole number")
+		}
+		field.SetInt(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, field.Type().Bits())
+		if err != nil {
+			return argErr("a number")
+		}
+		field.SetFloat(f)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return argErr("true or false")
 		}
+		field.SetBool(b)
+	default:
+		return fmt.Errorf("unsupported type %s for arg %s", field.Type(), name)
 	}
+	return nil
+}
+
+func parseArgTags(field reflect.StructField) (argType, bool, error) {
+	var (
+		fieldArgType argType
+		required     bool
+	)
 
-	err = ErrNoMatchingSpec
-	return
+	switch field.Tag.Get("argtype") {
+	case "named":
+		fieldArgType = named
+	case "positional":
+		fieldArgType = positional
+	case "rest":
+		fieldArgType = rest
+	default:
+		return 0, false, fmt.Errorf("invalid argtype, must be 'named', 'positional' or 'rest': %s", field.Tag.Get("argtype"))
+	}
+
+	switch field.Tag.Get("required") {
+	case "true":
+		required = true
+	case "false":
+		required = false
+	default:
+		return 0, false, fmt.Errorf("invalid required value, must be 'true' or 'false': %s", field.Tag.Get("required"))
+	}
+
+	return fieldArgType, required, nil
+}
+
+// Converts TwitchUser args to the names expected by users.Resolver
+func twitchUserNames(users []TwitchUser) []string {
+	names := make([]string, len(users))
+	for i, user := range users {
+		names[i] = string(user)
+	}
+	return names
 }
@@ -1,9 +1,243 @@
 package command
 
-import "testing"
+import (
+	"errors"
+	"monkebot/types"
+	"reflect"
+	"testing"
+	"time"
+)
 
 func TestParseArgs(t *testing.T) {
 	if parseArgs("") != nil || parseArgs("\test") != nil || parseArgs("\test:") != nil || parseArgs("\test:hi") != nil {
 		t.Fatal("failed to parse single argument to nil")
 	}
 }
+
+func TestGetFirstMatchingArgSpec(t *testing.T) {
+	type channelSpec struct {
+		Channels []string `argtype:"positional" required:"false"`
+	}
+	type levelSpec struct {
+		Username   string `argtype:"positional" required:"true"`
+		Permission string `argtype:"positional" required:"true"`
+		Reason     string `argtype:"named" required:"false"`
+	}
+
+	result, err := getFirstMatchingArgSpec(parseArgs("setlevel alice admin reason:trusted"), &levelSpec{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *result.(*levelSpec) != (levelSpec{"alice", "admin", "trusted"}) {
+		t.Errorf("unexpected args: %+v", result)
+	}
+
+	for _, msg := range []string{"setlevel", "setlevel alice", "setlevel alice admin banned", "setlevel alice admin other:arg"} {
+		_, err = getFirstMatchingArgSpec(parseArgs(msg), &levelSpec{})
+		if err != ErrNoMatchingSpec {
+			t.Errorf("expected ErrNoMatchingSpec for '%s', got %v", msg, err)
+		}
+	}
+
+	// the first matching spec is used
+	result, err = getFirstMatchingArgSpec(parseArgs("join  a b  c"), &levelSpec{}, &channelSpec{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if channels := result.(*channelSpec).Channels; len(channels) != 3 || channels[0] != "a" || channels[2] != "c" {
+		t.Errorf("unexpected channels: %v", channels)
+	}
+
+	result, err = getFirstMatchingArgSpec(parseArgs("join"), &channelSpec{})
+	if err != nil || result.(*channelSpec).Channels != nil {
+		t.Errorf("expected no channels, got %+v, %v", result, err)
+	}
+
+	_, err = getFirstMatchingArgSpec(parseArgs("join"), channelSpec{})
+	if err == nil || err == ErrNoMatchingSpec {
+		t.Errorf("expected an error for a spec that isn't a pointer, got %v", err)
+	}
+}
+
+func TestSetMessageArgs(t *testing.T) {
+	sender := &MockSender{}
+	message := &types.Message{Channel: "test"}
+
+	ok, err := setMessageArgs(message, sender, setLevel, "setlevel alice")
+	if err != nil || ok {
+		t.Fatalf("expected the args not to match, got %v, %v", ok, err)
+	}
+	if len(sender.responses) != 1 || sender.responses[0] != "🐒 Usage: "+setLevel.Usage {
+		t.Errorf("expected the usage to be sent, got %v", sender.responses)
+	}
+
+	ok, err = setMessageArgs(message, sender, setLevel, "setlevel alice admin")
+	if err != nil || !ok {
+		t.Fatalf("expected the args to match, got %v, %v", ok, err)
+	}
+	if *message.Args.(*setLevelArgs) != (setLevelArgs{"alice", "admin"}) {
+		t.Errorf("unexpected args: %+v", message.Args)
+	}
+}
+
+func TestParseQuotedArgs(t *testing.T) {
+	positional, named := parseArgs(`remind @Alice "take out the trash" in:"1h 30m" "" a"b c"`).forSpec(map[string]bool{"in": true})
+	expected := []string{"@Alice", "take out the trash", "", "ab c"}
+	if !reflect.DeepEqual(positional, expected) {
+		t.Errorf("expected positional args %q, got %q", expected, positional)
+	}
+	if named["in"] != "1h 30m" {
+		t.Errorf("expected named arg 'in' to be '1h 30m', got %q", named["in"])
+	}
+
+	// quoted colons don't make named args, and an unterminated quote takes the rest of the message
+	positional, named = parseArgs(`say "a:b" "unterminated quote`).forSpec(map[string]bool{"a": true})
+	expected = []string{"a:b", "unterminated quote"}
+	if !reflect.DeepEqual(positional, expected) || len(named) != 0 {
+		t.Errorf("expected positional args %q, got %q and named args %v", expected, positional, named)
+	}
+}
+
+func TestColonArgs(t *testing.T) {
+	type remindSpec struct {
+		At      string `argtype:"positional" required:"true"`
+		Link    string `argtype:"positional" required:"false"`
+		Channel string `argtype:"named" required:"false"`
+	}
+
+	// only args named after a named field are named args
+	tests := []struct {
+		msg      string
+		expected remindSpec
+	}{
+		{"remind 12:30 https://example.com/a:b", remindSpec{"12:30", "https://example.com/a:b", ""}},
+		{"remind D: channel:alice", remindSpec{"D:", "", "alice"}},
+		{`remind "12:30" Channel:"alice"`, remindSpec{"12:30", "", "alice"}},
+	}
+	for _, test := range tests {
+		result, err := getFirstMatchingArgSpec(parseArgs(test.msg), &remindSpec{})
+		if err != nil {
+			t.Errorf("unexpected error for '%s': %v", test.msg, err)
+			continue
+		}
+		if *result.(*remindSpec) != test.expected {
+			t.Errorf("expected %+v for '%s', got %+v", test.expected, test.msg, result)
+		}
+	}
+
+	type addSpec struct {
+		Name     string `argtype:"positional" required:"true"`
+		Response string `argtype:"rest" required:"true"`
+	}
+	result, err := getFirstMatchingArgSpec(parseArgs("addcmd time:zone 12:30 at https://example.com"), &addSpec{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *result.(*addSpec) != (addSpec{"time:zone", "12:30 at https://example.com"}) {
+		t.Errorf("unexpected args: %+v", result)
+	}
+}
+
+func TestTypedArgs(t *testing.T) {
+	type wagerSpec struct {
+		User    TwitchUser    `argtype:"positional" required:"true"`
+		Amount  int           `argtype:"positional" required:"true"`
+		Odds    float64       `argtype:"named" required:"false" default:"0.5"`
+		Public  bool          `argtype:"named" required:"false" default:"true"`
+		Expires time.Duration `argtype:"named" required:"false" default:"1m"`
+		Rolls   []int         `argtype:"positional" required:"false"`
+	}
+
+	result, err := getFirstMatchingArgSpec(parseArgs("wager @Alice 50 odds:0.25 expires:1h30m 1 2 3"), &wagerSpec{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := wagerSpec{"alice", 50, 0.25, true, 90 * time.Minute, []int{1, 2, 3}}
+	if !reflect.DeepEqual(*result.(*wagerSpec), expected) {
+		t.Errorf("expected %+v, got %+v", expected, result)
+	}
+
+	result, err = getFirstMatchingArgSpec(parseArgs("wager alice 50 public:false"), &wagerSpec{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected = wagerSpec{"alice", 50, 0.5, false, time.Minute, nil}
+	if !reflect.DeepEqual(*result.(*wagerSpec), expected) {
+		t.Errorf("expected %+v, got %+v", expected, result)
+	}
+
+	invalid := map[string]string{
+		"wager alice lots":              "invalid amount 'lots', expected a whole number",
+		"wager alice 50 1 two":          "invalid rolls 'two', expected a whole number",
+		"wager alice 50 expires:soon":   "invalid expires 'soon', expected a duration like 10m or 1h30m",
+		"wager alice 50 public:perhaps": "invalid public 'perhaps', expected true or false",
+		"wager @ 50":                    "invalid user '@', expected a username",
+	}
+	for msg, expectedErr := range invalid {
+		_, err = getFirstMatchingArgSpec(parseArgs(msg), &wagerSpec{})
+		var argErr *ArgError
+		if !errors.As(err, &argErr) || err.Error() != expectedErr {
+			t.Errorf("expected '%s' for '%s', got %v", expectedErr, msg, err)
+		}
+	}
+
+	// a spec that matches is used even if another one had an invalid value
+	type nameSpec struct {
+		Name string `argtype:"positional" required:"true"`
+	}
+	type numberSpec struct {
+		Number int `argtype:"positional" required:"true"`
+	}
+	result, err = getFirstMatchingArgSpec(parseArgs("cmd abc"), &numberSpec{}, &nameSpec{})
+	if err != nil || result.(*nameSpec).Name != "abc" {
+		t.Errorf("expected the name spec to match, got %+v, %v", result, err)
+	}
+
+	type badDefaultSpec struct {
+		Number int `argtype:"positional" required:"false" default:"abc"`
+	}
+	_, err = getFirstMatchingArgSpec(parseArgs("cmd"), &badDefaultSpec{})
+	var argErr *ArgError
+	if err == nil || errors.As(err, &argErr) {
+		t.Errorf("expected an invalid default to be a spec error, got %v", err)
+	}
+}
+
+// catches invalid tags and defaults of the commands' specs
+func TestCommandArgSpecs(t *testing.T) {
+	for _, cmd := range Commands {
+		for _, argSpec := range cmd.ArgSpecs {
+			_, err := fillArgSpec(&cmdArgs{}, argSpec)
+			if err != nil {
+				t.Errorf("invalid arg spec for command %s: %v", cmd.Name, err)
+			}
+		}
+	}
+}
+
+func TestRestArg(t *testing.T) {
+	type addSpec struct {
+		Name     string `argtype:"positional" required:"true"`
+		Response string `argtype:"rest" required:"true"`
+	}
+
+	result, err := getFirstMatchingArgSpec(parseArgs(`addcmd  discord  Join "us" at https://discord.gg/x  `), &addSpec{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := addSpec{"discord", `Join "us" at https://discord.gg/x`}
+	if *result.(*addSpec) != expected {
+		t.Errorf("expected %+v, got %+v", expected, result)
+	}
+
+	// the rest can start with something that looks like a named arg
+	result, err = getFirstMatchingArgSpec(parseArgs("addcmd discord https://discord.gg/x"), &addSpec{})
+	if err != nil || result.(*addSpec).Response != "https://discord.gg/x" {
+		t.Errorf("expected the url as the response, got %+v, %v", result, err)
+	}
+
+	_, err = getFirstMatchingArgSpec(parseArgs("addcmd discord"), &addSpec{})
+	if err != ErrNoMatchingSpec {
+		t.Errorf("expected ErrNoMatchingSpec without a response, got %v", err)
+	}
+}
@@ -19,7 +19,8 @@ var butt = types.Command{
 	NoPrefixShouldRun: func(message *types.Message, sender types.MessageSender, args []string) bool {
 		return buttRegexp.MatchString(message.Message)
 	},
-	CanDisable: true,
+	CanDisable:   true,
+	RequiredRole: types.RoleEveryone,
 	Execute: func(message *types.Message, sender types.MessageSender, args []string) error {
 		if rand.IntN(100) == 1 {
 			sender.Say(message.Channel, "buttConcerned")
@@ -13,7 +13,8 @@ var buttsbot = types.Command{
 	NoPrefixShouldRun: func(message *types.Message, sender types.MessageSender, args []string) bool {
 		return sender.ShouldButtify()
 	},
-	CanDisable: true,
+	CanDisable:   true,
+	RequiredRole: types.RoleEveryone,
 	Execute: func(message *types.Message, sender types.MessageSender, args []string) error {
 		newSentence := sender.Buttify(message.Message)
 		if newSentence != message.Message {
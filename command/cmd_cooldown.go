@@ -0,0 +1,98 @@
+package command
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"monkebot/database"
+	"monkebot/types"
+	"strings"
+)
+
+// a day, longer cooldowns would be better off disabling the command
+const maxCooldown = 24 * 60 * 60
+
+type cooldownArgs struct {
+	// subcommands are quoted, like "explore stats"
+	Command string `argtype:"positional" required:"true"`
+	Kind    string `argtype:"positional" required:"true"`
+	Seconds int    `argtype:"positional" required:"true"`
+}
+
+var cooldown = types.Command{
+	Name:              "cooldown",
+	Aliases:           []string{},
+	Usage:             `cooldown <command> channel|user <seconds> | cooldown "<command> <subcommand>" channel|user <seconds>`,
+	Description:       "Change the channel or user cooldown of a built-in or custom command in the channel, it can't be shorter than the default",
+	ChannelCooldown:   2,
+	UserCooldown:      2,
+	NoPrefix:          false,
+	NoPrefixShouldRun: nil,
+	CanDisable:        false,
+	RequiredRole:      types.RoleMod,
+	ArgSpecs:          []interface{}{&cooldownArgs{}},
+	Execute: func(message *types.Message, sender types.MessageSender, args []string) error {
+		overrideArgs := message.Args.(*cooldownArgs)
+		kind := strings.ToLower(overrideArgs.Kind)
+		if kind != "channel" && kind != "user" {
+			sender.Say(message.Channel, fmt.Sprintf("❌Unknown cooldown '%s', it must be channel or user", overrideArgs.Kind))
+			return nil
+		}
+
+		tx, err := message.DB.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		var (
+			name           string
+			update         func(tx *sql.Tx, channelID string, name string, seconds int) error
+			defaultSeconds int
+		)
+		if command, ok := findCommand(strings.Fields(strings.ToLower(overrideArgs.Command))...); ok {
+			name = command.Name
+			update, defaultSeconds = database.UpdateCommandChannelCooldown, command.ChannelCooldown
+			if kind == "user" {
+				update, defaultSeconds = database.UpdateCommandUserCooldown, command.UserCooldown
+			}
+		} else {
+			// the channel's custom commands start with the same cooldowns
+			var custom *database.CustomCommand
+			custom, err = database.SelectCustomCommand(tx, message.RoomID, strings.ToLower(strings.TrimPrefix(overrideArgs.Command, message.Prefix)))
+			if err == sql.ErrNoRows {
+				sender.Say(message.Channel, fmt.Sprintf("❌Unknown command '%s'", overrideArgs.Command))
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("failed to select custom command: %w", err)
+			}
+			name = custom.Name
+			update, defaultSeconds = database.UpdateCustomCommandChannelCooldown, customCommandChannelCooldown
+			if kind == "user" {
+				update, defaultSeconds = database.UpdateCustomCommandUserCooldown, customCommandUserCooldown
+			}
+		}
+
+		if overrideArgs.Seconds < defaultSeconds || overrideArgs.Seconds > maxCooldown {
+			sender.Say(message.Channel, fmt.Sprintf("❌The %s cooldown of %s must be from %d to %d seconds", kind, name, defaultSeconds, maxCooldown))
+			return nil
+		}
+
+		err = update(tx, message.RoomID, name, overrideArgs.Seconds)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("command %s isn't in the database for channel %s", name, message.Channel)
+		}
+		if err != nil {
+			return err
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			return err
+		}
+
+		sender.Say(message.Channel, fmt.Sprintf("✅The %s cooldown of %s is now %ds", kind, name, overrideArgs.Seconds))
+		return nil
+	},
+}
@@ -0,0 +1,362 @@
+package command
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"monkebot/database"
+	"monkebot/template"
+	"monkebot/types"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/rs/zerolog/log"
+)
+
+// default cooldowns of custom commands in seconds, mods can make them longer with the cooldown command
+const (
+	customCommandChannelCooldown = 5
+	customCommandUserCooldown    = 10
+)
+
+// leaves room in the 500 characters twitch allows for the reply prefix
+const maxCustomResponseLength = 400
+
+var customCommandNameRegex = regexp.MustCompile(`^[\p{L}\p{N}_-]{1,25}$`)
+
+// Runs the channel's custom command called by args, returning false if there's none with that name.
+// It's handled like a built-in command, with cooldowns and enable/disable, but can't be opted out of.
+func handleCustomCommand(tx *sql.Tx, message *types.Message, sender types.MessageSender, args []string) (bool, error) {
+	custom, err := database.SelectCustomCommand(tx, message.RoomID, strings.ToLower(args[0]))
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to select custom command: %w", err)
+	}
+
+	err = database.InsertUsers(tx, false, struct{ ID, Name string }{message.Chatter.ID, message.Chatter.Name})
+	if err != nil {
+		return true, err
+	}
+
+	cmdData, err := getCustomCommandData(tx, message, custom)
+	if err != nil {
+		return true, err
+	}
+	if !shouldExecute(message, custom.Name, cmdData) {
+		return true, nil
+	}
+
+	err = database.UpdateCustomCommandLastUsed(tx, custom.ID, message.Chatter.ID)
+	if err != nil {
+		return true, err
+	}
+
+	// in the transaction, so ${count} only goes up when the response is sent
+	response, err := template.Render(custom.Response, &template.Data{
+		Tx:        tx,
+		ChannelID: message.RoomID,
+		Channel:   message.Channel,
+		UserID:    message.Chatter.ID,
+		User:      message.Chatter.Name,
+		Command:   custom.Name,
+		Args:      args[1:],
+		Uptime:    sender.Uptime(),
+	})
+	if err != nil {
+		return true, fmt.Errorf("failed to render response of custom command %s: %w", custom.Name, err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return true, fmt.Errorf("failed to commit transaction to update last_used for custom command %s: %w", custom.Name, err)
+	}
+
+	sender.Say(message.Channel, response)
+	return true, nil
+}
+
+func getCustomCommandData(tx *sql.Tx, message *types.Message, custom *database.CustomCommand) (*commandData, error) {
+	result := &commandData{isCmdEnabled: custom.IsEnabled}
+
+	var err error
+	result.isUserIgnored, err = database.SelectIsUserIgnored(tx, message.Chatter.ID)
+	if err == sql.ErrNoRows {
+		result.isUserIgnored = false
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to select user's is_ignored: %w", err)
+	}
+
+	channelCooldown, userCooldown := customCommandCooldowns(custom)
+	result.isCmdOnChannelCoolDown, err = database.SelectIsCustomCommandOnChannelCooldown(tx, custom.ID, channelCooldown)
+	if err != nil {
+		return nil, err
+	}
+
+	result.isCmdOnUserCoolDown, err = database.SelectIsCustomCommandOnUserCooldown(tx, custom.ID, message.Chatter.ID, userCooldown)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Returns the channel and user cooldowns of the custom command, the defaults unless a mod changed them
+func customCommandCooldowns(custom *database.CustomCommand) (int, int) {
+	channelCooldown, userCooldown := customCommandChannelCooldown, customCommandUserCooldown
+	if custom.ChannelCooldown != nil {
+		channelCooldown = *custom.ChannelCooldown
+	}
+	if custom.UserCooldown != nil {
+		userCooldown = *custom.UserCooldown
+	}
+	return channelCooldown, userCooldown
+}
+
+// Returns the name a custom command is saved as, without the prefix and in lowercase.
+// The error is meant for the user.
+func customCommandName(message *types.Message, name string) (string, error) {
+	name = strings.ToLower(strings.TrimPrefix(name, message.Prefix))
+	if !customCommandNameRegex.MatchString(name) {
+		return "", fmt.Errorf("Command names must have up to 25 letters, numbers, - or _")
+	}
+	if _, ok := findCommand(name); ok {
+		return "", fmt.Errorf("'%s' is a built-in command", name)
+	}
+	return name, nil
+}
+
+// The error is meant for the user
+func validateCustomResponse(response string) error {
+	if utf8.RuneCountInString(response) > maxCustomResponseLength {
+		return fmt.Errorf("Responses can have up to %d characters", maxCustomResponseLength)
+	}
+	_, err := template.Parse(response)
+	if err != nil {
+		return fmt.Errorf("Invalid response, %w", err)
+	}
+	return nil
+}
+
+type customCommandArgs struct {
+	Name     string `argtype:"positional" required:"true"`
+	Response string `argtype:"rest" required:"true"`
+}
+
+var addCmd = types.Command{
+	Name:              "addcmd",
+	Aliases:           []string{},
+	Usage:             "addcmd <name> <response>",
+	Description:       "Add a command to the channel that replies with the response, which can use variables like ${user}, ${args.1}, ${count} or ${random 1 100}",
+	ChannelCooldown:   2,
+	UserCooldown:      2,
+	NoPrefix:          false,
+	NoPrefixShouldRun: nil,
+	CanDisable:        false,
+	RequiredRole:      types.RoleMod,
+	ArgSpecs:          []interface{}{&customCommandArgs{}},
+	Execute: func(message *types.Message, sender types.MessageSender, args []string) error {
+		customArgs := message.Args.(*customCommandArgs)
+		name, err := customCommandName(message, customArgs.Name)
+		if err == nil {
+			err = validateCustomResponse(customArgs.Response)
+		}
+		if err != nil {
+			sender.Say(message.Channel, "❌"+err.Error())
+			return nil
+		}
+
+		tx, err := message.DB.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		_, err = database.SelectCustomCommand(tx, message.RoomID, name)
+		if err == nil {
+			sender.Say(message.Channel, fmt.Sprintf("❌Command '%s' already exists, use %seditcmd to change it", name, message.Prefix))
+			return nil
+		}
+		if err != sql.ErrNoRows {
+			return err
+		}
+
+		err = database.InsertCustomCommand(tx, message.RoomID, name, customArgs.Response)
+		if err != nil {
+			return err
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			return err
+		}
+
+		log.Info().Str("channel", message.Channel).Str("command", name).Str("user", message.Chatter.Name).Msg("added custom command")
+		sender.Say(message.Channel, fmt.Sprintf("✅Added command '%s'", name))
+		return nil
+	},
+}
+
+var editCmd = types.Command{
+	Name:              "editcmd",
+	Aliases:           []string{},
+	Usage:             "editcmd <name> <response>",
+	Description:       "Change the response of one of the channel's commands",
+	ChannelCooldown:   2,
+	UserCooldown:      2,
+	NoPrefix:          false,
+	NoPrefixShouldRun: nil,
+	CanDisable:        false,
+	RequiredRole:      types.RoleMod,
+	ArgSpecs:          []interface{}{&customCommandArgs{}},
+	Execute: func(message *types.Message, sender types.MessageSender, args []string) error {
+		customArgs := message.Args.(*customCommandArgs)
+		name := strings.ToLower(strings.TrimPrefix(customArgs.Name, message.Prefix))
+		err := validateCustomResponse(customArgs.Response)
+		if err != nil {
+			sender.Say(message.Channel, "❌"+err.Error())
+			return nil
+		}
+
+		tx, err := message.DB.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		err = database.UpdateCustomCommandResponse(tx, message.RoomID, name, customArgs.Response)
+		if errors.Is(err, sql.ErrNoRows) {
+			sender.Say(message.Channel, fmt.Sprintf("❌Unknown command '%s'", name))
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			return err
+		}
+
+		sender.Say(message.Channel, fmt.Sprintf("✅Updated command '%s'", name))
+		return nil
+	},
+}
+
+type delCmdArgs struct {
+	Name string `argtype:"positional" required:"true"`
+}
+
+var delCmd = types.Command{
+	Name:              "delcmd",
+	Aliases:           []string{},
+	Usage:             "delcmd <name>",
+	Description:       "Delete one of the channel's commands",
+	ChannelCooldown:   2,
+	UserCooldown:      2,
+	NoPrefix:          false,
+	NoPrefixShouldRun: nil,
+	CanDisable:        false,
+	RequiredRole:      types.RoleMod,
+	ArgSpecs:          []interface{}{&delCmdArgs{}},
+	Execute: func(message *types.Message, sender types.MessageSender, args []string) error {
+		name := strings.ToLower(strings.TrimPrefix(message.Args.(*delCmdArgs).Name, message.Prefix))
+
+		tx, err := message.DB.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		err = database.DeleteCustomCommand(tx, message.RoomID, name)
+		if errors.Is(err, sql.ErrNoRows) {
+			sender.Say(message.Channel, fmt.Sprintf("❌Unknown command '%s'", name))
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			return err
+		}
+
+		log.Info().Str("channel", message.Channel).Str("command", name).Str("user", message.Chatter.Name).Msg("deleted custom command")
+		sender.Say(message.Channel, fmt.Sprintf("✅Deleted command '%s'", name))
+		return nil
+	},
+}
+
+var listCmds = types.Command{
+	Name:              "listcmds",
+	Aliases:           []string{},
+	Usage:             "listcmds",
+	Description:       "List the commands added to the channel",
+	ChannelCooldown:   5,
+	UserCooldown:      5,
+	NoPrefix:          false,
+	NoPrefixShouldRun: nil,
+	CanDisable:        false,
+	RequiredRole:      types.RoleMod,
+	Execute: func(message *types.Message, sender types.MessageSender, args []string) error {
+		tx, err := message.DB.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		customCommands, err := database.SelectCustomCommands(tx, message.RoomID)
+		if err != nil {
+			return err
+		}
+
+		if len(customCommands) == 0 {
+			sender.Say(message.Channel, fmt.Sprintf("🐒 No commands were added yet, add one with %saddcmd <name> <response>", message.Prefix))
+			return nil
+		}
+
+		names := make([]string, len(customCommands))
+		for i, custom := range customCommands {
+			names[i] = message.Prefix + custom.Name
+			if !custom.IsEnabled {
+				names[i] += " (disabled)"
+			}
+		}
+		sender.Say(message.Channel, fmt.Sprintf("🐒 Commands: %s", strings.Join(names, ", ")))
+		return nil
+	},
+}
+
+// Enables or disables the channel's custom command for enable and disable, which only know built-in commands
+func setCustomCommandEnabled(message *types.Message, sender types.MessageSender, name string, enabled bool) error {
+	tx, err := message.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	name = strings.ToLower(strings.TrimPrefix(name, message.Prefix))
+	err = database.UpdateIsCustomCommandEnabled(tx, enabled, message.RoomID, name)
+	if errors.Is(err, sql.ErrNoRows) {
+		sender.Say(message.Channel, fmt.Sprintf("❌Unknown command '%s'", name))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	if enabled {
+		sender.Say(message.Channel, fmt.Sprintf("✅Enabled command '%s'", name))
+	} else {
+		sender.Say(message.Channel, fmt.Sprintf("✅Disabled command '%s'", name))
+	}
+	return nil
+}
@@ -4,51 +4,39 @@ import (
 	"fmt"
 	"monkebot/database"
 	"monkebot/types"
+	"strings"
 )
 
+type disableArgs struct {
+	Command []string `argtype:"positional" required:"true"`
+}
+
 var disable = types.Command{
 	Name:              "disable",
 	Aliases:           []string{},
-	Usage:             "disable [command]",
+	Usage:             "disable <command>",
 	Description:       "Disables a command for all users in the channel",
 	ChannelCooldown:   5,
 	UserCooldown:      5,
 	NoPrefix:          false,
 	NoPrefixShouldRun: nil,
 	CanDisable:        false,
+	RequiredRole:      types.RoleMod,
+	ArgSpecs:          []interface{}{&disableArgs{}},
 	Execute: func(message *types.Message, sender types.MessageSender, args []string) error {
-		if len(args) != 2 {
-			sender.Say(message.Channel, "Usage: disable [command]")
-			return nil
-		}
+		commandName := message.Args.(*disableArgs).Command
 
-		var (
-			command types.Command
-			ok      bool
-			err     error
-		)
-		if command, ok = commandMap[args[1]]; !ok {
-			found := false
-			for _, cmd := range commandsNoPrefix {
-				if cmd.Name == args[1] {
-					command = cmd
-					found = true
-					break
-				}
-			}
-			if !found {
-				sender.Say(message.Channel, fmt.Sprintf("❌Unknown command '%s'", args[1]))
-				return nil
-			}
+		command, ok := findCommand(commandName...)
+		if !ok && len(commandName) == 1 {
+			return setCustomCommandEnabled(message, sender, commandName[0], false)
 		}
-
-		if !command.CanDisable {
-			sender.Say(message.Channel, "❌This command cannot be disabled")
+		if !ok {
+			sender.Say(message.Channel, fmt.Sprintf("❌Unknown command '%s'", strings.Join(commandName, " ")))
 			return nil
 		}
 
-		if !(message.Chatter.IsMod || message.Chatter.IsBroadcaster) {
-			sender.Say(message.Channel, "❌You must be a moderator to use this command")
+		if !command.CanDisable {
+			sender.Say(message.Channel, "❌This command cannot be disabled")
 			return nil
 		}
 
@@ -58,9 +46,12 @@ var disable = types.Command{
 		}
 		defer tx.Rollback()
 
-		err = database.UpdateIsUserCommandEnabled(tx, false, message.RoomID, command.Name)
-		if err != nil {
-			return err
+		// subcommands are disabled with their command
+		for _, name := range commandNames(command) {
+			err = database.UpdateIsUserCommandEnabled(tx, false, message.RoomID, name)
+			if err != nil {
+				return err
+			}
 		}
 
 		err = tx.Commit()
@@ -6,6 +6,7 @@ import (
 	"math/rand/v2"
 	"monkebot/database"
 	"monkebot/types"
+	"monkebot/users"
 
 	"github.com/rs/zerolog/log"
 )
@@ -20,6 +21,8 @@ var explore = types.Command{
 	NoPrefix:          false,
 	NoPrefixShouldRun: nil,
 	CanDisable:        true,
+	RequiredRole:      types.RoleEveryone,
+	Subcommands:       []types.Command{exploreStats},
 	Execute: func(message *types.Message, sender types.MessageSender, args []string) error {
 		tx, err := message.DB.Begin()
 		if err != nil {
@@ -110,3 +113,54 @@ var explore = types.Command{
 		return nil
 	},
 }
+
+type exploreStatsArgs struct {
+	User TwitchUser `argtype:"positional" required:"false"`
+}
+
+var exploreStats = types.Command{
+	Name:              "stats",
+	Aliases:           []string{"s"},
+	Usage:             "explore stats | explore stats [user]",
+	Description:       "Show how many buttinhos you or another user collected exploring",
+	ChannelCooldown:   5,
+	UserCooldown:      10,
+	NoPrefix:          false,
+	NoPrefixShouldRun: nil,
+	CanDisable:        true,
+	RequiredRole:      types.RoleEveryone,
+	ArgSpecs:          []interface{}{&exploreStatsArgs{}},
+	Execute: func(message *types.Message, sender types.MessageSender, args []string) error {
+		tx, err := message.DB.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		user := users.User{ID: message.Chatter.ID, Name: message.Chatter.Name}
+		if name := string(message.Args.(*exploreStatsArgs).User); name != "" {
+			var resolvedUsers []users.User
+			resolvedUsers, err = message.Users.ResolveNames(tx, name)
+			if err != nil {
+				return err
+			}
+			if len(resolvedUsers) == 0 {
+				sender.Say(message.Channel, fmt.Sprintf("❌User '%s' not found", name))
+				return nil
+			}
+			user = resolvedUsers[0]
+		}
+
+		// users that never explored have no buttinho
+		amount, err := database.SelectUserItemAmount(tx, user.ID, "buttinho")
+		if err != nil {
+			return err
+		}
+
+		sender.Say(message.Channel, fmt.Sprintf("🐒 %s has %d buttinho", user.Name, amount), struct {
+			Param types.SenderParam
+			Value string
+		}{Param: types.ReplyMessageID, Value: message.ID})
+		return nil
+	},
+}
@@ -0,0 +1,169 @@
+package command
+
+import (
+	"database/sql"
+	"fmt"
+	"monkebot/database"
+	"monkebot/types"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// deletions wait this long for the confirmation
+var forgetConfirmations = newConfirmations(time.Minute)
+
+type forgetMeArgs struct {
+	Confirm string `argtype:"positional" required:"false"`
+}
+
+var forgetMe = types.Command{
+	Name:              "forgetme",
+	Aliases:           []string{},
+	Usage:             "forgetme | forgetme confirm",
+	Description:       "Delete all your data, including opt-outs and rpg items. The bot leaves your channel if it was joined",
+	ChannelCooldown:   0,
+	UserCooldown:      2,
+	NoPrefix:          false,
+	NoPrefixShouldRun: nil,
+	CanDisable:        false,
+	RequiredRole:      types.RoleEveryone,
+	ArgSpecs:          []interface{}{&forgetMeArgs{}},
+	Execute: func(message *types.Message, sender types.MessageSender, args []string) error {
+		reply := struct {
+			Param types.SenderParam
+			Value string
+		}{Param: types.ReplyMessageID, Value: message.ID}
+
+		confirm := message.Args.(*forgetMeArgs).Confirm
+		if confirm == "" {
+			forgetConfirmations.request(message.Chatter.ID)
+			sender.Say(message.Channel, fmt.Sprintf("⚠️ This deletes all your data, including opt-outs and rpg items, and the bot leaves your channel. Use %sforgetme confirm within a minute to continue", message.Prefix), reply)
+			return nil
+		}
+
+		if confirm != "confirm" {
+			sender.Say(message.Channel, "🐒 Usage: forgetme | forgetme confirm", reply)
+			return nil
+		}
+
+		if !forgetConfirmations.confirm(message.Chatter.ID) {
+			sender.Say(message.Channel, fmt.Sprintf("❌ Nothing to confirm, use %sforgetme first", message.Prefix), reply)
+			return nil
+		}
+
+		tx, err := message.DB.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		var joinedChannel string
+		joinedChannel, err = deleteUserData(tx, message, message.Chatter.ID)
+		if err != nil {
+			return err
+		}
+
+		sender.Say(message.Channel, "✅ Your data was deleted. Using commands again saves your name again", reply)
+		// after replying, in case this is the user's own channel
+		if joinedChannel != "" {
+			sender.Part(joinedChannel)
+		}
+		return nil
+	},
+}
+
+type forgetUserArgs struct {
+	Username TwitchUser `argtype:"positional" required:"true"`
+	Confirm  string     `argtype:"positional" required:"false"`
+}
+
+var forgetUser = types.Command{
+	Name:              "forgetuser",
+	Aliases:           []string{},
+	Usage:             "forgetuser <username> | forgetuser <username> confirm",
+	Description:       "Delete all data of a user, the bot leaves their channel if it was joined",
+	ChannelCooldown:   0,
+	UserCooldown:      2,
+	NoPrefix:          false,
+	NoPrefixShouldRun: nil,
+	CanDisable:        false,
+	RequiredRole:      types.RoleBotAdmin,
+	ArgSpecs:          []interface{}{&forgetUserArgs{}},
+	Execute: func(message *types.Message, sender types.MessageSender, args []string) error {
+		forgetArgs := message.Args.(*forgetUserArgs)
+		if forgetArgs.Confirm != "" && forgetArgs.Confirm != "confirm" {
+			sender.Say(message.Channel, "❌Usage: forgetuser <username> | forgetuser <username> confirm")
+			return nil
+		}
+
+		tx, err := message.DB.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		// only users in the database have data to delete, so helix isn't needed
+		var found []struct{ ID, Name string }
+		found, err = database.SelectUsersByName(tx, string(forgetArgs.Username))
+		if err != nil {
+			return err
+		}
+		if len(found) == 0 {
+			sender.Say(message.Channel, fmt.Sprintf("❌User '%s' not found", forgetArgs.Username))
+			return nil
+		}
+		user := found[0]
+
+		// the admin confirms deleting this specific user
+		key := message.Chatter.ID + ":" + user.ID
+		if forgetArgs.Confirm == "" {
+			forgetConfirmations.request(key)
+			sender.Say(message.Channel, fmt.Sprintf("⚠️ This deletes all of %s's data. Use %sforgetuser %s confirm within a minute to continue", user.Name, message.Prefix, user.Name))
+			return nil
+		}
+
+		if !forgetConfirmations.confirm(key) {
+			sender.Say(message.Channel, fmt.Sprintf("❌ Nothing to confirm, use %sforgetuser %s first", message.Prefix, user.Name))
+			return nil
+		}
+
+		var joinedChannel string
+		joinedChannel, err = deleteUserData(tx, message, user.ID)
+		if err != nil {
+			return err
+		}
+
+		sender.Say(message.Channel, fmt.Sprintf("✅ Deleted %s's data", user.Name))
+		if joinedChannel != "" {
+			sender.Part(joinedChannel)
+		}
+		log.Info().Str("admin", message.Chatter.Name).Str("user", user.Name).Msg("admin deleted user data")
+		return nil
+	},
+}
+
+// Deletes a user's data and commits tx, returning the user's channel if the bot was joined to it, so it can be parted.
+// Users that aren't in the database are ignored, since there's nothing to delete.
+func deleteUserData(tx *sql.Tx, message *types.Message, userID string) (string, error) {
+	name, wasJoined, err := database.DeleteUser(tx, userID)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return "", err
+	}
+
+	message.Users.Forget(userID)
+
+	if !wasJoined {
+		return "", nil
+	}
+	log.Info().Str("channel", name).Msg("leaving channel of deleted user")
+	return name, nil
+}
@@ -1,46 +1,78 @@
 package command
 
 import (
+	"database/sql"
 	"fmt"
+	"monkebot/database"
 	"monkebot/types"
+	"strings"
 )
 
+type helpArgs struct {
+	Command []string `argtype:"positional" required:"false"`
+}
+
 var help = types.Command{
 	Name:              "help",
 	Aliases:           []string{"commands"},
-	Usage:             "help | help [command]",
+	Usage:             "help | help [command] | help [command] [subcommand]",
 	Description:       "Get the full list of commands, or help with a specific command",
 	ChannelCooldown:   5,
 	UserCooldown:      5,
 	NoPrefix:          false,
 	NoPrefixShouldRun: nil,
 	CanDisable:        false,
+	RequiredRole:      types.RoleEveryone,
+	ArgSpecs:          []interface{}{&helpArgs{}},
 	Execute: func(message *types.Message, sender types.MessageSender, args []string) error {
-		if len(args) <= 1 {
+		commandName := message.Args.(*helpArgs).Command
+		if len(commandName) == 0 {
 			sender.Say(message.Channel, "🐒 Commands: https://douglascdev.github.io/monkebot/ ● For help with a specific command: help <command>")
 			return nil
 		}
 
-		var (
-			command types.Command
-			ok      bool
-		)
-		if command, ok = commandMap[args[1]]; !ok {
-			found := false
-			for _, cmd := range commandsNoPrefix {
-				if cmd.Name == args[1] {
-					command = cmd
-					found = true
-					break
-				}
+		tx, err := message.DB.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		command, ok := findCommand(commandName...)
+		if !ok && len(commandName) == 1 {
+			var custom *database.CustomCommand
+			custom, err = database.SelectCustomCommand(tx, message.RoomID, strings.ToLower(commandName[0]))
+			if err != nil && err != sql.ErrNoRows {
+				return fmt.Errorf("failed to select custom command: %w", err)
 			}
-			if !found {
-				sender.Say(message.Channel, fmt.Sprintf("❌Unknown command '%s'", args[1]))
+			if err == nil {
+				channelCooldown, userCooldown := customCommandCooldowns(custom)
+				sender.Say(message.Channel, fmt.Sprintf("🐒 %s is a custom command of the channel ● Cooldown: %ds, %ds per user", custom.Name, channelCooldown, userCooldown))
 				return nil
 			}
 		}
+		if !ok {
+			sender.Say(message.Channel, fmt.Sprintf("❌Unknown command '%s'", strings.Join(commandName, " ")))
+			return nil
+		}
 
-		sender.Say(message.Channel, fmt.Sprintf("🐒 Usage: %s", command.Usage))
+		// the cooldowns that apply in the channel, which mods can change
+		channelCooldown, userCooldown, err := database.SelectCommandCooldowns(tx, message.RoomID, command.Name, command.ChannelCooldown, command.UserCooldown)
+		if err != nil {
+			return err
+		}
+
+		answer := fmt.Sprintf("🐒 Usage: %s ● Cooldown: %ds, %ds per user", command.Usage, channelCooldown, userCooldown)
+		if command.RequiredRole != types.RoleEveryone {
+			answer += fmt.Sprintf(" ● Role: %s", command.RequiredRole)
+		}
+		if len(command.Subcommands) > 0 {
+			subcommands := make([]string, len(command.Subcommands))
+			for i, subcommand := range command.Subcommands {
+				subcommands[i] = subcommand.Name
+			}
+			answer += fmt.Sprintf(" ● Subcommands: %s ● For help with one: help %s <subcommand>", strings.Join(subcommands, ", "), command.Name)
+		}
+		sender.Say(message.Channel, answer)
 		return nil
 	},
 }
@@ -4,23 +4,28 @@ import (
 	"database/sql"
 	"fmt"
 	"monkebot/database"
-	"monkebot/twitchapi"
 	"monkebot/types"
 	"strings"
 
 	"github.com/rs/zerolog/log"
 )
 
+// no args, other channels are joined with the channel subcommand
+type joinArgs struct{}
+
 var join = types.Command{
 	Name:              "join",
 	Aliases:           []string{},
-	Usage:             "join | join [channel]",
-	Description:       "Join the message author's channel or the specified channel",
+	Usage:             "join | join channel <channels>",
+	Description:       "Join the message author's channel",
 	ChannelCooldown:   5,
 	UserCooldown:      5,
 	NoPrefix:          false,
 	NoPrefixShouldRun: nil,
 	CanDisable:        false,
+	RequiredRole:      types.RoleEveryone,
+	Subcommands:       []types.Command{joinChannel},
+	ArgSpecs:          []interface{}{&joinArgs{}},
 	Execute: func(message *types.Message, sender types.MessageSender, args []string) error {
 		tx, err := message.DB.Begin()
 		if err != nil {
@@ -28,145 +33,140 @@ var join = types.Command{
 		}
 		defer tx.Rollback()
 
-		var channelsToJoin []struct {
-			ID   string
-			Name string
-		}
-
-		if len(args) == 2 && message.Chatter.Name == args[1] {
-			channelsToJoin = append(channelsToJoin, struct {
-				ID   string
-				Name string
-			}{ID: message.Chatter.ID, Name: message.Chatter.Name})
-		} else if len(args) > 1 {
-			isAdmin := false
-			isAdmin, err = database.SelectIsUserAdmin(tx, message.Chatter.ID)
-
-			if err != nil && err != sql.ErrNoRows {
-				return err
-			}
-
-			if err == sql.ErrNoRows || !isAdmin {
-				sender.Say(message.Channel, "❌You must be an admin to use this command")
-				return nil
-			}
-
-			var twitchUsers *[]twitchapi.HelixUser
-			twitchUsers, err = twitchapi.GetUserByName(message.Cfg, args[1:]...)
-			if err != nil {
-				return err
-			}
-			channelsToJoin = make([]struct {
-				ID   string
-				Name string
-			}, 0, len(*twitchUsers))
-
-			for _, user := range *twitchUsers {
-				channelsToJoin = append(channelsToJoin, struct {
-					ID   string
-					Name string
-				}{ID: user.ID, Name: user.Login})
-			}
-		} else {
-			channelsToJoin = append(channelsToJoin, struct {
-				ID   string
-				Name string
-			}{ID: message.Chatter.ID, Name: message.Chatter.Name})
-		}
-
-		if len(channelsToJoin) == 0 {
-			sender.Say(message.Channel, "❌Channel(s) not found")
-			return nil
-		}
-
-		// check if any of the channels are already in the database
-		var (
-			query    string
-			rows     *sql.Rows
-			channels []interface{}
-		)
-		query = fmt.Sprintf("SELECT name FROM user WHERE name IN (%s) AND bot_is_joined", strings.Repeat("?,", max(0, len(channelsToJoin)-1))+"?")
-		channels = make([]interface{}, len(channelsToJoin))
-		for i, channel := range channelsToJoin {
-			channels[i] = channel.Name
-		}
-
-		rows, err = tx.Query(query, channels...)
-		if err == nil {
-			defer rows.Close()
-			var foundChannels []string
-			for rows.Next() {
-				var name string
-				err = rows.Scan(&name)
-				if err != nil {
-					return err
-				}
-				foundChannels = append(foundChannels, name)
-			}
-			err = rows.Err()
-			if err != nil {
-				return err
-			}
+		return joinChannels(tx, message, sender, []struct{ ID, Name string }{{message.Chatter.ID, message.Chatter.Name}})
+	},
+}
 
-			if len(foundChannels) > 0 {
-				answer := fmt.Sprintf("❌The following channels were already joined: %s", strings.Join(foundChannels, ", "))
-				sender.Say(message.Channel, answer)
-				return nil
-			}
-		}
+type joinChannelArgs struct {
+	Channels []TwitchUser `argtype:"positional" required:"true"`
+}
 
-		err = database.InsertUsers(tx, true, channelsToJoin...)
+var joinChannel = types.Command{
+	Name:              "channel",
+	Aliases:           []string{},
+	Usage:             "join channel <channels>",
+	Description:       "Join other channels",
+	ChannelCooldown:   5,
+	UserCooldown:      5,
+	NoPrefix:          false,
+	NoPrefixShouldRun: nil,
+	CanDisable:        false,
+	RequiredRole:      types.RoleBotAdmin,
+	ArgSpecs:          []interface{}{&joinChannelArgs{}},
+	Execute: func(message *types.Message, sender types.MessageSender, args []string) error {
+		tx, err := message.DB.Begin()
 		if err != nil {
 			return err
 		}
+		defer tx.Rollback()
 
-		// ensure all joined channels have bot_is_joined set to true if InsertUsers didn't just insert them(it skips existing users)
-		var channelIDs []string
-		for _, channel := range channelsToJoin {
-			channelIDs = append(channelIDs, channel.ID)
-		}
-		err = database.UpdateIsBotJoined(tx, true, channelIDs...)
+		resolvedUsers, err := message.Users.ResolveNames(tx, twitchUserNames(message.Args.(*joinChannelArgs).Channels)...)
 		if err != nil {
 			return err
 		}
-
-		var commandNames []string
-		rows, err = tx.Query("SELECT name FROM command")
-		if err != nil {
-			return err
+		channelsToJoin := make([]struct{ ID, Name string }, 0, len(resolvedUsers))
+		for _, user := range resolvedUsers {
+			channelsToJoin = append(channelsToJoin, struct{ ID, Name string }{user.ID, user.Name})
 		}
+		return joinChannels(tx, message, sender, channelsToJoin)
+	},
+}
+
+// Joins the channels and commits tx
+func joinChannels(tx *sql.Tx, message *types.Message, sender types.MessageSender, channelsToJoin []struct{ ID, Name string }) error {
+	if len(channelsToJoin) == 0 {
+		sender.Say(message.Channel, "❌Channel(s) not found")
+		return nil
+	}
+
+	// check if any of the channels are already in the database
+	var (
+		err      error
+		query    string
+		rows     *sql.Rows
+		channels []interface{}
+	)
+	query = fmt.Sprintf(`SELECT name FROM "user" WHERE name IN (%s) AND bot_is_joined`, strings.Repeat("?,", max(0, len(channelsToJoin)-1))+"?")
+	channels = make([]interface{}, len(channelsToJoin))
+	for i, channel := range channelsToJoin {
+		channels[i] = channel.Name
+	}
+
+	rows, err = tx.Query(query, channels...)
+	if err == nil {
 		defer rows.Close()
+		var foundChannels []string
 		for rows.Next() {
 			var name string
 			err = rows.Scan(&name)
 			if err != nil {
 				return err
 			}
-			commandNames = append(commandNames, name)
+			foundChannels = append(foundChannels, name)
 		}
-
-		for _, channel := range channelsToJoin {
-			err = database.InsertUserCommands(tx, channel.ID, commandNames...)
-			if err != nil {
-				log.Warn().Err(err).Str("channel", channel.Name).Msg("failed to insert user commands after join, skipping channel")
-			}
+		err = rows.Err()
+		if err != nil {
+			return err
 		}
 
-		err = tx.Commit()
+		if len(foundChannels) > 0 {
+			answer := fmt.Sprintf("❌The following channels were already joined: %s", strings.Join(foundChannels, ", "))
+			sender.Say(message.Channel, answer)
+			return nil
+		}
+	}
+
+	err = database.InsertUsers(tx, true, channelsToJoin...)
+	if err != nil {
+		return err
+	}
+
+	// ensure all joined channels have bot_is_joined set to true if InsertUsers didn't just insert them(it skips existing users)
+	var channelIDs []string
+	for _, channel := range channelsToJoin {
+		channelIDs = append(channelIDs, channel.ID)
+	}
+	err = database.UpdateIsBotJoined(tx, true, channelIDs...)
+	if err != nil {
+		return err
+	}
+
+	var commandNames []string
+	rows, err = tx.Query("SELECT name FROM command")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		err = rows.Scan(&name)
 		if err != nil {
 			return err
 		}
+		commandNames = append(commandNames, name)
+	}
 
-		channelNames := make([]string, len(channelsToJoin))
-		for i, channel := range channelsToJoin {
-			channelNames[i] = channel.Name
-		}
-		log.Info().Strs("channels", channelNames).Msg("successfully joined channels")
-		sender.Join(channelNames...)
-		sender.Say(message.Channel, fmt.Sprintf("✅ Joined channel(s) %s", strings.Join(channelNames, ", ")))
-		for _, channel := range channelsToJoin {
-			sender.Say(channel.Name, "ola")
+	for _, channel := range channelsToJoin {
+		err = database.InsertUserCommands(tx, channel.ID, commandNames...)
+		if err != nil {
+			log.Warn().Err(err).Str("channel", channel.Name).Msg("failed to insert user commands after join, skipping channel")
 		}
-		return nil
-	},
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	channelNames := make([]string, len(channelsToJoin))
+	for i, channel := range channelsToJoin {
+		channelNames[i] = channel.Name
+	}
+	log.Info().Strs("channels", channelNames).Msg("successfully joined channels")
+	sender.Join(channelNames...)
+	sender.Say(message.Channel, fmt.Sprintf("✅ Joined channel(s) %s", strings.Join(channelNames, ", ")))
+	for _, channel := range channelsToJoin {
+		sender.Say(channel.Name, "ola")
+	}
+	return nil
 }
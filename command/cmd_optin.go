@@ -3,24 +3,26 @@ package command
 import (
 	"database/sql"
 	"monkebot/types"
+	"strings"
 )
 
+type optinArgs struct {
+	Command []string `argtype:"positional" required:"true"`
+}
+
 var optin = types.Command{
 	Name:              "optin",
 	Aliases:           []string{},
-	Usage:             "optin [all] | optin [command]",
+	Usage:             "optin all | optin <command>",
 	Description:       "Opt in to one or all commands",
 	ChannelCooldown:   5,
 	UserCooldown:      5,
 	NoPrefix:          false,
 	NoPrefixShouldRun: nil,
 	CanDisable:        false,
+	RequiredRole:      types.RoleEveryone,
+	ArgSpecs:          []interface{}{&optinArgs{}},
 	Execute: func(message *types.Message, sender types.MessageSender, args []string) error {
-		if len(args) != 2 {
-			sender.Say(message.Channel, "🐒 Usage: optin [all] | optin [command]")
-			return nil
-		}
-
 		tx, err := message.DB.Begin()
 		if err != nil {
 			return err
@@ -31,7 +33,7 @@ var optin = types.Command{
 			fn func(tx *sql.Tx, userID string, optOut bool) error
 			ok bool
 		)
-		if fn, ok = optoutOptions[args[1]]; !ok {
+		if fn, ok = optoutOptions[strings.Join(message.Args.(*optinArgs).Command, " ")]; !ok {
 			sender.Say(message.Channel, "❌ Unknown command")
 			return nil
 		}
@@ -3,24 +3,26 @@ package command
 import (
 	"database/sql"
 	"monkebot/types"
+	"strings"
 )
 
+type optoutArgs struct {
+	Command []string `argtype:"positional" required:"true"`
+}
+
 var optout = types.Command{
 	Name:              "optout",
 	Aliases:           []string{},
-	Usage:             "optout [all] | optout [command]",
+	Usage:             "optout all | optout <command>",
 	Description:       "Opt out of one or all commands",
 	ChannelCooldown:   5,
 	UserCooldown:      5,
 	NoPrefix:          false,
 	NoPrefixShouldRun: nil,
 	CanDisable:        false,
+	RequiredRole:      types.RoleEveryone,
+	ArgSpecs:          []interface{}{&optoutArgs{}},
 	Execute: func(message *types.Message, sender types.MessageSender, args []string) error {
-		if len(args) != 2 {
-			sender.Say(message.Channel, "🐒 Usage: optout [all] | optout [command]")
-			return nil
-		}
-
 		tx, err := message.DB.Begin()
 		if err != nil {
 			return err
@@ -31,7 +33,7 @@ var optout = types.Command{
 			fn func(tx *sql.Tx, userID string, optOut bool) error
 			ok bool
 		)
-		if fn, ok = optoutOptions[args[1]]; !ok {
+		if fn, ok = optoutOptions[strings.Join(message.Args.(*optoutArgs).Command, " ")]; !ok {
 			sender.Say(message.Channel, "❌ Unknown command")
 			return nil
 		}
@@ -20,6 +20,7 @@ var ping = types.Command{
 	NoPrefix:          false,
 	NoPrefixShouldRun: nil,
 	CanDisable:        false,
+	RequiredRole:      types.RoleEveryone,
 	Execute: func(message *types.Message, sender types.MessageSender, args []string) error {
 		responses := []string{
 			"🐒 Pong!",
@@ -0,0 +1,190 @@
+package command
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"monkebot/database"
+	"monkebot/types"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// how long channel prefixes are kept in memory, changes made with the prefix command show up right away
+const prefixCacheTTL = 10 * time.Minute
+
+const maxPrefixLength = 10
+
+type cachedPrefix struct {
+	prefix    string // empty for the default
+	expiresAt time.Time
+}
+
+var prefixCache = struct {
+	sync.Mutex
+	prefixes map[string]cachedPrefix // by channel id
+}{prefixes: make(map[string]cachedPrefix)}
+
+// Returns the channel's prefix, or defaultPrefix if it didn't set one
+func channelPrefix(tx *sql.Tx, channelID string, defaultPrefix string) (string, error) {
+	prefixCache.Lock()
+	cached, ok := prefixCache.prefixes[channelID]
+	prefixCache.Unlock()
+
+	if !ok || time.Now().After(cached.expiresAt) {
+		prefix, err := database.SelectChannelPrefix(tx, channelID)
+		if err != nil {
+			return "", err
+		}
+		cached = cacheChannelPrefix(channelID, prefix)
+	}
+
+	if cached.prefix == "" {
+		return defaultPrefix, nil
+	}
+	return cached.prefix, nil
+}
+
+func cacheChannelPrefix(channelID string, prefix string) cachedPrefix {
+	cached := cachedPrefix{prefix: prefix, expiresAt: time.Now().Add(prefixCacheTTL)}
+	prefixCache.Lock()
+	prefixCache.prefixes[channelID] = cached
+	prefixCache.Unlock()
+	return cached
+}
+
+// Returns msg without the prefix, or without a mention of the bot like "@monkebot ping", which works with any prefix.
+// Returns false if msg has neither.
+func trimCommandPrefix(msg string, prefix string, login string) (string, bool) {
+	if rest, ok := strings.CutPrefix(msg, prefix); ok {
+		return rest, true
+	}
+
+	mention, rest, found := strings.Cut(msg, " ")
+	mention = strings.TrimRight(mention, ",:")
+	if !found || login == "" || !strings.EqualFold(mention, "@"+login) {
+		return msg, false
+	}
+
+	rest = strings.TrimLeft(rest, " ")
+	return rest, rest != ""
+}
+
+// Returns whether name is a built-in command or one of the channel's custom commands
+func isCommandName(tx *sql.Tx, channelID string, name string) (bool, error) {
+	if _, ok := commandMap[name]; ok {
+		return true, nil
+	}
+	_, err := database.SelectCustomCommand(tx, channelID, strings.ToLower(name))
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to select custom command: %w", err)
+	}
+	return true, nil
+}
+
+// The error is meant for the user
+func validatePrefix(prefix string) error {
+	if utf8.RuneCountInString(prefix) > maxPrefixLength {
+		return fmt.Errorf("The prefix can have up to %d characters", maxPrefixLength)
+	}
+	// twitch commands and mentions of the bot
+	if strings.HasPrefix(prefix, "/") || strings.HasPrefix(prefix, ".") || strings.HasPrefix(prefix, "@") {
+		return fmt.Errorf("The prefix can't start with /, . or @")
+	}
+	return nil
+}
+
+var prefixCmd = types.Command{
+	Name:              "prefix",
+	Aliases:           []string{},
+	Usage:             "prefix | prefix set <prefix> | prefix reset",
+	Description:       "Show or change the channel's prefix, mentioning the bot like @bot ping works with any prefix",
+	ChannelCooldown:   5,
+	UserCooldown:      5,
+	NoPrefix:          false,
+	NoPrefixShouldRun: nil,
+	CanDisable:        false,
+	RequiredRole:      types.RoleEveryone,
+	Subcommands:       []types.Command{prefixSet, prefixReset},
+	Execute: func(message *types.Message, sender types.MessageSender, args []string) error {
+		sender.Say(message.Channel, fmt.Sprintf("🐒 The prefix is %s", message.Prefix))
+		return nil
+	},
+}
+
+type prefixSetArgs struct {
+	Prefix string `argtype:"positional" required:"true"`
+}
+
+var prefixSet = types.Command{
+	Name:              "set",
+	Aliases:           []string{},
+	Usage:             "prefix set <prefix>",
+	Description:       "Change the channel's prefix",
+	ChannelCooldown:   5,
+	UserCooldown:      5,
+	NoPrefix:          false,
+	NoPrefixShouldRun: nil,
+	CanDisable:        false,
+	RequiredRole:      types.RoleMod,
+	ArgSpecs:          []interface{}{&prefixSetArgs{}},
+	Execute: func(message *types.Message, sender types.MessageSender, args []string) error {
+		return changeChannelPrefix(message, sender, message.Args.(*prefixSetArgs).Prefix)
+	},
+}
+
+var prefixReset = types.Command{
+	Name:              "reset",
+	Aliases:           []string{},
+	Usage:             "prefix reset",
+	Description:       "Change the channel's prefix back to the default",
+	ChannelCooldown:   5,
+	UserCooldown:      5,
+	NoPrefix:          false,
+	NoPrefixShouldRun: nil,
+	CanDisable:        false,
+	RequiredRole:      types.RoleMod,
+	Execute: func(message *types.Message, sender types.MessageSender, args []string) error {
+		return changeChannelPrefix(message, sender, "")
+	},
+}
+
+// Changes the channel's prefix, an empty prefix goes back to the default
+func changeChannelPrefix(message *types.Message, sender types.MessageSender, newPrefix string) error {
+	err := validatePrefix(newPrefix)
+	if err != nil {
+		sender.Say(message.Channel, "❌"+err.Error())
+		return nil
+	}
+
+	tx, err := message.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = database.UpdateChannelPrefix(tx, message.RoomID, newPrefix)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("channel %s isn't in the database", message.Channel)
+	}
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	cacheChannelPrefix(message.RoomID, newPrefix)
+
+	if newPrefix == "" {
+		newPrefix = message.Cfg.Prefix
+	}
+	sender.Say(message.Channel, fmt.Sprintf("✅The prefix is now %s", newPrefix))
+	return nil
+}
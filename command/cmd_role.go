@@ -0,0 +1,183 @@
+package command
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"monkebot/database"
+	"monkebot/types"
+	"monkebot/users"
+	"slices"
+	"strings"
+)
+
+const roleUsage = "role add <user> <role> | role remove <user> <role> | role list"
+
+var roleCmd = types.Command{
+	Name:              "role",
+	Aliases:           []string{"roles"},
+	Usage:             roleUsage,
+	Description:       "Give users a role in the channel: editors can manage the bot like mods, and trusted is for commands meant for trusted users",
+	ChannelCooldown:   2,
+	UserCooldown:      2,
+	NoPrefix:          false,
+	NoPrefixShouldRun: nil,
+	CanDisable:        false,
+	RequiredRole:      types.RoleEveryone,
+	Subcommands:       []types.Command{roleAdd, roleRemove, roleList},
+	Execute: func(message *types.Message, sender types.MessageSender, args []string) error {
+		sender.Say(message.Channel, fmt.Sprintf("🐒 Usage: %s ● Roles: %s", roleUsage, channelRoleNames()))
+		return nil
+	},
+}
+
+type roleArgs struct {
+	User TwitchUser `argtype:"positional" required:"true"`
+	Role string     `argtype:"positional" required:"true"`
+}
+
+var roleAdd = types.Command{
+	Name:              "add",
+	Aliases:           []string{},
+	Usage:             "role add <user> <role>",
+	Description:       "Give a user a role in the channel",
+	ChannelCooldown:   2,
+	UserCooldown:      2,
+	NoPrefix:          false,
+	NoPrefixShouldRun: nil,
+	CanDisable:        false,
+	RequiredRole:      types.RoleBroadcaster,
+	ArgSpecs:          []interface{}{&roleArgs{}},
+	Execute: func(message *types.Message, sender types.MessageSender, args []string) error {
+		return changeChannelRole(message, sender, true)
+	},
+}
+
+var roleRemove = types.Command{
+	Name:              "remove",
+	Aliases:           []string{"rm"},
+	Usage:             "role remove <user> <role>",
+	Description:       "Take a role in the channel from a user",
+	ChannelCooldown:   2,
+	UserCooldown:      2,
+	NoPrefix:          false,
+	NoPrefixShouldRun: nil,
+	CanDisable:        false,
+	RequiredRole:      types.RoleBroadcaster,
+	ArgSpecs:          []interface{}{&roleArgs{}},
+	Execute: func(message *types.Message, sender types.MessageSender, args []string) error {
+		return changeChannelRole(message, sender, false)
+	},
+}
+
+var roleList = types.Command{
+	Name:              "list",
+	Aliases:           []string{"ls"},
+	Usage:             "role list",
+	Description:       "List the users with a role in the channel",
+	ChannelCooldown:   5,
+	UserCooldown:      5,
+	NoPrefix:          false,
+	NoPrefixShouldRun: nil,
+	CanDisable:        false,
+	RequiredRole:      types.RoleBroadcaster,
+	Execute: func(message *types.Message, sender types.MessageSender, args []string) error {
+		tx, err := message.DB.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		channelRoles, err := database.SelectChannelRoles(tx, message.RoomID)
+		if err != nil {
+			return err
+		}
+		if len(channelRoles) == 0 {
+			sender.Say(message.Channel, "🐒 Nobody has a role in the channel yet, give one with role add <user> <role>")
+			return nil
+		}
+
+		// sorted by role, so users with the same role are next to each other
+		var groups []string
+		for i, channelRole := range channelRoles {
+			if i == 0 || channelRoles[i-1].Role != channelRole.Role {
+				groups = append(groups, fmt.Sprintf("%s: %s", channelRole.Role, channelRole.UserName))
+				continue
+			}
+			groups[len(groups)-1] += ", " + channelRole.UserName
+		}
+		sender.Say(message.Channel, "🐒 "+strings.Join(groups, " ● "))
+		return nil
+	},
+}
+
+// Adds or removes the role in message.Args
+func changeChannelRole(message *types.Message, sender types.MessageSender, add bool) error {
+	changeArgs := message.Args.(*roleArgs)
+	channelRole := types.Role(strings.ToLower(changeArgs.Role))
+	if !slices.Contains(types.ChannelRoles, channelRole) {
+		sender.Say(message.Channel, fmt.Sprintf("❌Unknown role '%s', it must be one of: %s", changeArgs.Role, channelRoleNames()))
+		return nil
+	}
+
+	tx, err := message.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var resolvedUsers []users.User
+	resolvedUsers, err = message.Users.ResolveNames(tx, string(changeArgs.User))
+	if err != nil {
+		return err
+	}
+	if len(resolvedUsers) == 0 {
+		sender.Say(message.Channel, fmt.Sprintf("❌User '%s' not found", changeArgs.User))
+		return nil
+	}
+	user := resolvedUsers[0]
+
+	var answer string
+	if add {
+		err = database.InsertUsers(tx, false, struct{ ID, Name string }{user.ID, user.Name})
+		if err != nil {
+			return err
+		}
+
+		var added bool
+		added, err = database.InsertChannelRole(tx, message.RoomID, user.ID, string(channelRole))
+		if err != nil {
+			return err
+		}
+		answer = fmt.Sprintf("✅%s now has the role %s", user.Name, channelRole)
+		if !added {
+			answer = fmt.Sprintf("🐒 %s already has the role %s", user.Name, channelRole)
+		}
+	} else {
+		err = database.DeleteChannelRole(tx, message.RoomID, user.ID, string(channelRole))
+		if errors.Is(err, sql.ErrNoRows) {
+			sender.Say(message.Channel, fmt.Sprintf("❌%s doesn't have the role %s", user.Name, channelRole))
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		answer = fmt.Sprintf("✅%s no longer has the role %s", user.Name, channelRole)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	sender.Say(message.Channel, answer)
+	return nil
+}
+
+func channelRoleNames() string {
+	names := make([]string, len(types.ChannelRoles))
+	for i, channelRole := range types.ChannelRoles {
+		names[i] = string(channelRole)
+	}
+	return strings.Join(names, ", ")
+}
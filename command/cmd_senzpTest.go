@@ -23,6 +23,7 @@ var senzpTest = types.Command{
 	NoPrefix:          true,
 	NoPrefixShouldRun: shouldRun,
 	CanDisable:        true,
+	RequiredRole:      types.RoleEveryone,
 	Execute: func(message *types.Message, sender types.MessageSender, args []string) error {
 		cleanString := func(s string) string {
 			cleaned := []rune{}
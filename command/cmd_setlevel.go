@@ -3,27 +3,31 @@ package command
 import (
 	"fmt"
 	"monkebot/database"
-	"monkebot/twitchapi"
 	"monkebot/types"
+	"monkebot/users"
 
 	"github.com/rs/zerolog/log"
 )
 
+type setLevelArgs struct {
+	Username   TwitchUser `argtype:"positional" required:"true"`
+	Permission string     `argtype:"positional" required:"true"`
+}
+
 var setLevel = types.Command{
 	Name:              "setlevel",
 	Aliases:           []string{"permission", "perm", "level"},
-	Usage:             "setlevel [username] [permission]",
+	Usage:             "setlevel <username> <permission>",
 	Description:       "Set a user's permission level",
 	ChannelCooldown:   5,
 	UserCooldown:      5,
 	NoPrefix:          false,
 	NoPrefixShouldRun: nil,
 	CanDisable:        false,
+	RequiredRole:      types.RoleBotAdmin,
+	ArgSpecs:          []interface{}{&setLevelArgs{}},
 	Execute: func(message *types.Message, sender types.MessageSender, args []string) error {
-		if len(args) != 3 {
-			sender.Say(message.Channel, "❌Usage: setlevel <username> <permission>")
-			return nil
-		}
+		levelArgs := message.Args.(*setLevelArgs)
 
 		tx, err := message.DB.Begin()
 		defer tx.Rollback()
@@ -31,38 +35,18 @@ var setLevel = types.Command{
 			return err
 		}
 
-		var isAdmin bool
-		isAdmin, err = database.SelectIsUserAdmin(tx, message.Chatter.ID)
+		var resolvedUsers []users.User
+		resolvedUsers, err = message.Users.ResolveNames(tx, string(levelArgs.Username))
 		if err != nil {
 			return err
 		}
-		if !isAdmin {
-			sender.Say(message.Channel, "❌You must be an admin to use this command")
+		if len(resolvedUsers) == 0 {
+			sender.Say(message.Channel, fmt.Sprintf("❌User '%s' not found", levelArgs.Username))
 			return nil
 		}
+		user := resolvedUsers[0]
 
-		var userExists bool
-		userExists, err = database.SelectUserExists(tx, args[1])
-		if err != nil {
-			return err
-		}
-
-		if !userExists {
-			var users *[]twitchapi.HelixUser
-			users, err = twitchapi.GetUserByName(message.Cfg, args[1])
-			if err != nil {
-				sender.Say(message.Channel, fmt.Sprintf("❌User '%s' not found", args[1]))
-				return err
-			}
-			user := (*users)[0]
-			// user isn't in the db but exists on twitch, so it's a new user
-			err = database.InsertUsers(tx, false, struct{ ID, Name string }{user.ID, user.Login})
-			if err != nil {
-				return err
-			}
-		}
-
-		err = database.UpdateUserPermission(tx, args[1], args[2])
+		err = database.UpdateUserPermission(tx, user.ID, levelArgs.Permission)
 		if err != nil {
 			return err
 		}
@@ -71,8 +55,8 @@ var setLevel = types.Command{
 			return err
 		}
 
-		sender.Say(message.Channel, fmt.Sprintf("✅ Updated %s's permission to %s!", args[1], args[2]))
-		log.Info().Str("channel", message.Channel).Str("user", message.Chatter.Name).Str("permission", args[2]).Msg("successfully updated user permission")
+		sender.Say(message.Channel, fmt.Sprintf("✅ Updated %s's permission to %s!", levelArgs.Username, levelArgs.Permission))
+		log.Info().Str("channel", message.Channel).Str("user", message.Chatter.Name).Str("permission", levelArgs.Permission).Msg("successfully updated user permission")
 
 		return nil
 	},
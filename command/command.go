@@ -7,6 +7,7 @@ import (
 	"monkebot/config"
 	"monkebot/database"
 	"monkebot/types"
+	"slices"
 	"strings"
 
 	"github.com/rs/zerolog/log"
@@ -26,6 +27,15 @@ var Commands = []types.Command{
 	disable,
 	optout,
 	optin,
+	forgetMe,
+	forgetUser,
+	addCmd,
+	editCmd,
+	delCmd,
+	listCmds,
+	prefixCmd,
+	cooldown,
+	roleCmd,
 }
 
 var UnknownCommandErr = errors.New("unknown command")
@@ -61,6 +71,72 @@ func createCommandMap(commands []types.Command) map[string]types.Command {
 	return cmdMap
 }
 
+// Names returns the names of all commands in the database, which are the full names for subcommands, like "explore stats"
+func Names() []string {
+	var names []string
+	for _, cmd := range Commands {
+		names = append(names, commandNames(cmd)...)
+	}
+	return names
+}
+
+// Returns the names of cmd and all of its subcommands
+func commandNames(cmd types.Command) []string {
+	names := []string{cmd.Name}
+	for _, subcommand := range cmd.Subcommands {
+		for _, name := range commandNames(subcommand) {
+			names = append(names, cmd.Name+" "+name)
+		}
+	}
+	return names
+}
+
+// Returns the subcommand called by args, where args[0] is cmd's name, and how many of the args are names of its
+// parent commands. The subcommand's Name is set to its full name, like "explore stats".
+// cmd is returned if args don't call a subcommand.
+func findSubcommand(cmd types.Command, args []string) (types.Command, int) {
+	depth := 0
+	for depth+1 < len(args) {
+		found := false
+		for _, subcommand := range cmd.Subcommands {
+			if subcommand.Name == args[depth+1] || slices.Contains(subcommand.Aliases, args[depth+1]) {
+				subcommand.Name = cmd.Name + " " + subcommand.Name
+				cmd, found = subcommand, true
+				break
+			}
+		}
+		if !found {
+			break
+		}
+		depth++
+	}
+	return cmd, depth
+}
+
+// Finds a command by its name or alias, including no-prefix commands, or a subcommand by its full name split into
+// names, like ["explore", "stats"]
+func findCommand(names ...string) (types.Command, bool) {
+	if len(names) == 0 {
+		return types.Command{}, false
+	}
+
+	cmd, ok := commandMap[names[0]]
+	if !ok {
+		for _, noPrefixCmd := range commandsNoPrefix {
+			if noPrefixCmd.Name == names[0] {
+				cmd, ok = noPrefixCmd, true
+				break
+			}
+		}
+	}
+	if !ok {
+		return types.Command{}, false
+	}
+
+	cmd, depth := findSubcommand(cmd, names)
+	return cmd, depth == len(names)-1
+}
+
 type commandData struct {
 	isCmdEnabled           bool
 	isCmdOnChannelCoolDown bool
@@ -97,12 +173,17 @@ func getCommandData(tx *sql.Tx, message *types.Message, cmd types.Command) (*com
 		return nil, fmt.Errorf("failed to select user's is_ignored: %w", err)
 	}
 
-	result.isCmdOnChannelCoolDown, err = database.SelectIsCommandOnChannelCooldown(tx, message.RoomID, cmd.Name, cmd.ChannelCooldown)
+	channelCooldown, userCooldown, err := database.SelectCommandCooldowns(tx, message.RoomID, cmd.Name, cmd.ChannelCooldown, cmd.UserCooldown)
+	if err != nil {
+		return nil, err
+	}
+
+	result.isCmdOnChannelCoolDown, err = database.SelectIsCommandOnChannelCooldown(tx, message.RoomID, cmd.Name, channelCooldown)
 	if err != nil {
 		return nil, fmt.Errorf("failed to select command cooldown: %w", err)
 	}
 
-	result.isCmdOnUserCoolDown, err = database.SelectIsCommandOnUserCooldown(tx, message.Chatter.ID, cmd.Name, cmd.UserCooldown)
+	result.isCmdOnUserCoolDown, err = database.SelectIsCommandOnUserCooldown(tx, message.Chatter.ID, cmd.Name, userCooldown)
 	if err != nil {
 		return nil, fmt.Errorf("failed to select user cooldown: %w", err)
 	}
@@ -115,6 +196,67 @@ func getCommandData(tx *sql.Tx, message *types.Message, cmd types.Command) (*com
 	return result, nil
 }
 
+// Returns false if a command with the data shouldn't run, logging why
+func shouldExecute(message *types.Message, commandName string, cmdData *commandData) bool {
+	if !cmdData.isCmdEnabled {
+		log.Debug().Str("command", commandName).Str("channel", message.Channel).Msg("ignored disabled command")
+		return false
+	}
+
+	if cmdData.isUserIgnored {
+		log.Debug().Str("user", message.Chatter.Name).Str("channel", message.Channel).Msg("ignored user")
+		return false
+	}
+
+	if cmdData.isCmdOnChannelCoolDown {
+		log.Debug().Str("command", commandName).Str("channel", message.Channel).Msg("command ignored due to channel cooldown")
+		return false
+	}
+
+	if cmdData.isCmdOnUserCoolDown {
+		log.Debug().Str("command", commandName).Str("channel", message.Channel).Msg("command ignored due to user command cooldown")
+		return false
+	}
+
+	if cmdData.isOptedOut {
+		log.Debug().Str("command", commandName).Str("channel", message.Channel).Msg("command ignored due to opt out")
+		return false
+	}
+
+	return true
+}
+
+// Parses the message's arguments into the command's first matching ArgSpec and sets it as message.Args.
+// If no ArgSpec matches, the command's usage is sent with the invalid arg if there is one, and false is returned.
+// It runs after last_used is updated, so usage replies have the same cooldowns as the command.
+func setMessageArgs(message *types.Message, sender types.MessageSender, cmd types.Command, msg string) (bool, error) {
+	if len(cmd.ArgSpecs) == 0 {
+		return true, nil
+	}
+
+	reply := struct {
+		Param types.SenderParam
+		Value string
+	}{Param: types.ReplyMessageID, Value: message.ID}
+
+	argSpec, err := getFirstMatchingArgSpec(parseArgs(msg), cmd.ArgSpecs...)
+	var argErr *ArgError
+	if errors.As(err, &argErr) {
+		sender.Say(message.Channel, fmt.Sprintf("❌ %s. Usage: %s", argErr, cmd.Usage), reply)
+		return false, nil
+	}
+	if err == ErrNoMatchingSpec {
+		sender.Say(message.Channel, fmt.Sprintf("🐒 Usage: %s", cmd.Usage), reply)
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to parse args for command %s: %w", cmd.Name, err)
+	}
+
+	message.Args = argSpec
+	return true, nil
+}
+
 func HandleCommands(message *types.Message, sender types.MessageSender, config *config.Config) error {
 	var (
 		cmdData *commandData
@@ -130,9 +272,21 @@ func HandleCommands(message *types.Message, sender types.MessageSender, config *
 	}
 	defer tx.Rollback()
 
-	hasPrefix := strings.HasPrefix(message.Message, config.Prefix)
+	message.Prefix, err = channelPrefix(tx, message.RoomID, config.Prefix)
+	if err != nil {
+		return err
+	}
+
+	commandMsg, hasPrefix := trimCommandPrefix(message.Message, message.Prefix, config.Login)
+	if hasPrefix && !strings.HasPrefix(message.Message, message.Prefix) {
+		// mentions are only commands when they name one, so chatting with the bot isn't answered with unknown command
+		hasPrefix, err = isCommandName(tx, message.RoomID, strings.SplitN(commandMsg, " ", 2)[0])
+		if err != nil {
+			return err
+		}
+	}
 	if hasPrefix {
-		args = strings.Split(message.Message[len(config.Prefix):], " ")
+		args = strings.Split(commandMsg, " ")
 	} else {
 		args = strings.Split(message.Message, " ")
 
@@ -148,29 +302,15 @@ func HandleCommands(message *types.Message, sender types.MessageSender, config *
 				if err != nil {
 					return err
 				}
-				if !cmdData.isCmdEnabled {
-					log.Debug().Str("command", noPrefixCmd.Name).Str("channel", message.Channel).Msg("ignored disabled no-prefix command")
-					return nil
-				}
-
-				if cmdData.isUserIgnored {
-					log.Debug().Str("user", message.Chatter.Name).Str("channel", message.Channel).Msg("ignored user")
-					return nil
-				}
-
-				if cmdData.isCmdOnChannelCoolDown {
-					log.Debug().Str("command", noPrefixCmd.Name).Str("channel", message.Channel).Msg("command ignored due to channel cooldown")
-					return nil
-				}
-
-				if cmdData.isCmdOnUserCoolDown {
-					log.Debug().Str("command", noPrefixCmd.Name).Str("channel", message.Channel).Msg("command ignored due to user command cooldown")
+				if !shouldExecute(message, noPrefixCmd.Name, cmdData) {
 					return nil
 				}
 
-				if cmdData.isOptedOut {
-					log.Debug().Str("command", noPrefixCmd.Name).Str("channel", message.Channel).Msg("command ignored due to opt out")
-					return nil
+				// no-prefix commands aren't called on purpose, so users without the role aren't told about it
+				var allowed bool
+				allowed, err = hasRole(tx, message, noPrefixCmd.RequiredRole)
+				if err != nil || !allowed {
+					return err
 				}
 
 				err = database.UpdateUserCommandLastUsed(tx, message.RoomID, noPrefixCmd.Name, message.Chatter.ID)
@@ -183,6 +323,12 @@ func HandleCommands(message *types.Message, sender types.MessageSender, config *
 					return fmt.Errorf("failed to commit transaction to update last_used for command %s: %w", noPrefixCmd.Name, err)
 				}
 
+				var hasArgs bool
+				hasArgs, err = setMessageArgs(message, sender, noPrefixCmd, message.Message)
+				if err != nil || !hasArgs {
+					return err
+				}
+
 				err = noPrefixCmd.Execute(message, sender, args)
 				if err != nil {
 					return err
@@ -196,6 +342,11 @@ func HandleCommands(message *types.Message, sender types.MessageSender, config *
 	}
 
 	if cmd, ok := commandMap[args[0]]; ok {
+		// args of subcommands start with their name, like the args of commands
+		var depth int
+		cmd, depth = findSubcommand(cmd, args)
+		args = args[depth:]
+
 		err = database.InsertUsers(tx, false, struct{ ID, Name string }{message.Chatter.ID, message.Chatter.Name})
 		if err != nil {
 			return err
@@ -205,28 +356,30 @@ func HandleCommands(message *types.Message, sender types.MessageSender, config *
 		if err != nil {
 			return err
 		}
-		if !cmdData.isCmdEnabled {
-			log.Debug().Str("command", cmd.Name).Str("channel", message.Channel).Msg("ignored disabled command")
+		if !shouldExecute(message, cmd.Name, cmdData) {
 			return nil
 		}
 
-		if cmdData.isUserIgnored {
-			log.Debug().Str("user", message.Chatter.Name).Str("channel", message.Channel).Msg("ignored user")
-			return nil
-		}
-
-		if cmdData.isCmdOnChannelCoolDown {
-			log.Debug().Str("command", cmd.Name).Str("channel", message.Channel).Msg("command ignored due to channel cooldown")
-			return nil
+		var allowed bool
+		allowed, err = hasRole(tx, message, cmd.RequiredRole)
+		if err != nil {
+			return err
 		}
+		if !allowed {
+			// only the user's cooldown, so the denial can't be spammed and users without the role can't put the
+			// command on cooldown for the channel
+			err = database.UpdateUserCommandDataLastUsed(tx, cmd.Name, message.Chatter.ID)
+			if err != nil {
+				return fmt.Errorf("failed to update last_used for command %s: %w", cmd.Name, err)
+			}
 
-		if cmdData.isCmdOnUserCoolDown {
-			log.Debug().Str("command", cmd.Name).Str("channel", message.Channel).Msg("command ignored due to user command cooldown")
-			return nil
-		}
+			err = tx.Commit()
+			if err != nil {
+				return fmt.Errorf("failed to commit transaction to update last_used for command %s: %w", cmd.Name, err)
+			}
 
-		if cmdData.isOptedOut {
-			log.Debug().Str("command", cmd.Name).Str("channel", message.Channel).Msg("command ignored due to opt out")
+			log.Debug().Str("command", cmd.Name).Str("user", message.Chatter.Name).Msg("command ignored due to missing role")
+			sender.Say(message.Channel, roleDeniedMessage(cmd.RequiredRole))
 			return nil
 		}
 
@@ -240,11 +393,22 @@ func HandleCommands(message *types.Message, sender types.MessageSender, config *
 			return fmt.Errorf("failed to commit transaction to update last_used for command %s: %w", cmd.Name, err)
 		}
 
+		var hasArgs bool
+		hasArgs, err = setMessageArgs(message, sender, cmd, strings.Join(args, " "))
+		if err != nil || !hasArgs {
+			return err
+		}
+
 		if err = cmd.Execute(message, sender, args); err != nil {
 			return err
 		}
 
 	} else if hasPrefix {
+		var handled bool
+		handled, err = handleCustomCommand(tx, message, sender, args)
+		if err != nil || handled {
+			return err
+		}
 		return fmt.Errorf("%w: '%s' called by '%s'", UnknownCommandErr, args, message.Chatter.Name)
 	}
 
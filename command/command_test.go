@@ -1,7 +1,17 @@
 package command
 
 import (
+	"database/sql"
+	"fmt"
+	"monkebot/config"
+	"monkebot/database"
+	"monkebot/twitchapi"
 	"monkebot/types"
+	"monkebot/users"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
 	"time"
@@ -36,6 +46,35 @@ func (m *MockSender) ShouldButtify() bool {
 	return true
 }
 
+// a database with a channel "1" that has every command
+func newTestDB(t *testing.T) *sql.DB {
+	db, err := database.InitDB("sqlite3", "file:"+filepath.Join(t.TempDir(), "test.db"), 0)
+	if err != nil {
+		t.Fatalf("failed to init database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	err = database.InsertCommands(tx, Names()...)
+	if err == nil {
+		err = database.InsertUsers(tx, true, struct{ ID, Name string }{"1", "channel"})
+	}
+	if err == nil {
+		err = database.InsertUserCommands(tx, "1", Names()...)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		t.Fatalf("failed to insert test channel: %v", err)
+	}
+	return db
+}
+
 func TestCommandMap(t *testing.T) {
 	expected, got := 0, len(commandMap)
 	for _, cmd := range Commands {
@@ -92,3 +131,414 @@ func TestCommandSenzp(t *testing.T) {
 		}
 	}
 }
+
+func TestFindSubcommand(t *testing.T) {
+	cmd, depth := findSubcommand(explore, []string{"explore", "s", "alice"})
+	if cmd.Name != "explore stats" || depth != 1 {
+		t.Errorf("expected 'explore stats' at depth 1, got '%s' at depth %d", cmd.Name, depth)
+	}
+
+	// the command runs when the next arg isn't a subcommand
+	cmd, depth = findSubcommand(explore, []string{"explore", "alice"})
+	if cmd.Name != "explore" || depth != 0 {
+		t.Errorf("expected 'explore' at depth 0, got '%s' at depth %d", cmd.Name, depth)
+	}
+
+	if _, ok := findCommand("e", "stats"); !ok {
+		t.Error("expected to find a subcommand through its command's alias")
+	}
+	if _, ok := findCommand("explore", "unknown"); ok {
+		t.Error("expected an unknown subcommand not to be found")
+	}
+
+	if !slices.Contains(Names(), "explore stats") {
+		t.Errorf("expected subcommands in the command names, got %v", Names())
+	}
+}
+
+func TestHelpSubcommands(t *testing.T) {
+	db := newTestDB(t)
+	sender := &MockSender{}
+	for _, names := range [][]string{{"explore"}, {"explore", "stats"}} {
+		err := help.Execute(&types.Message{Channel: "test", RoomID: "1", DB: db, Args: &helpArgs{names}}, sender, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	expected := []string{
+		fmt.Sprintf("🐒 Usage: explore ● Cooldown: %ds, %ds per user ● Subcommands: stats ● For help with one: help explore <subcommand>", explore.ChannelCooldown, explore.UserCooldown),
+		fmt.Sprintf("🐒 Usage: %s ● Cooldown: %ds, %ds per user", exploreStats.Usage, exploreStats.ChannelCooldown, exploreStats.UserCooldown),
+	}
+	if !slices.Equal(sender.responses, expected) {
+		t.Errorf("expected %q, got %q", expected, sender.responses)
+	}
+}
+
+func TestCustomCommandName(t *testing.T) {
+	message := &types.Message{Prefix: "!"}
+	tests := []struct {
+		input, expected string
+		valid           bool
+	}{
+		{"Discord", "discord", true},
+		{"!so", "so", true},
+		{"ping", "", false},
+		{"!e", "", false},
+		{"two words", "", false},
+		{strings.Repeat("a", 26), "", false},
+	}
+	for _, test := range tests {
+		name, err := customCommandName(message, test.input)
+		if (err == nil) != test.valid || name != test.expected {
+			t.Errorf("expected '%s' to give '%s' (valid: %t), got '%s': %v", test.input, test.expected, test.valid, name, err)
+		}
+	}
+}
+
+func TestTrimCommandPrefix(t *testing.T) {
+	tests := []struct {
+		msg, expected string
+		isCommand     bool
+	}{
+		{"?ping", "ping", true},
+		{"!ping", "!ping", false},
+		{"@Monkebot ping", "ping", true},
+		{"@monkebot, join   alice", "join   alice", true},
+		{"@monkebot", "@monkebot", false},
+		{"@monkebot ", "", false},
+		{"@someone ping", "@someone ping", false},
+	}
+	for _, test := range tests {
+		msg, isCommand := trimCommandPrefix(test.msg, "?", "monkebot")
+		if msg != test.expected || isCommand != test.isCommand {
+			t.Errorf("expected '%s' to give '%s' (command: %t), got '%s' (command: %t)", test.msg, test.expected, test.isCommand, msg, isCommand)
+		}
+	}
+
+	for _, prefix := range []string{"/", ".", "@", "this is too long"} {
+		if validatePrefix(prefix) == nil {
+			t.Errorf("expected prefix '%s' to be invalid", prefix)
+		}
+	}
+}
+
+func TestHandleCommandsMention(t *testing.T) {
+	db := newTestDB(t)
+	err := func() error {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		err = database.InsertCustomCommand(tx, "1", "hi", "hello ${user}")
+		if err != nil {
+			return err
+		}
+		return tx.Commit()
+	}()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{Prefix: "!", Login: "monkebot"}
+	sender := &MockSender{}
+	for _, msg := range []string{"@monkebot hello how are you", "@monkebot, hi", "@MonkeBot: disable butt"} {
+		message := &types.Message{Message: msg, Channel: "channel", RoomID: "1", DB: db, Cfg: cfg, Chatter: types.Chatter{ID: "2", Name: "chatter"}}
+		err = HandleCommands(message, sender, cfg)
+		if err != nil {
+			t.Fatalf("unexpected error for '%s': %v", msg, err)
+		}
+	}
+
+	// chatting with the bot isn't a command, so nothing is said about it
+	expected := []string{"hello chatter", "❌You must be a moderator or editor to use this command"}
+	if !slices.Equal(sender.responses, expected) {
+		t.Errorf("expected %q, got %q", expected, sender.responses)
+	}
+}
+
+func TestPrefixCommands(t *testing.T) {
+	db := newTestDB(t)
+	cfg := &config.Config{Prefix: "!"}
+	sender := &MockSender{}
+	chatter, mod := types.Chatter{ID: "2", Name: "chatter"}, types.Chatter{ID: "3", Name: "mod", IsMod: true}
+	for _, test := range []struct {
+		msg     string
+		chatter types.Chatter
+	}{
+		{"!prefix set ?", chatter},
+		{"!prefix set ?", mod},
+		{"?prefix", chatter},
+		{"?prefix reset", mod},
+	} {
+		message := &types.Message{Message: test.msg, Channel: "channel", RoomID: "1", DB: db, Cfg: cfg, Chatter: test.chatter}
+		err := HandleCommands(message, sender, cfg)
+		if err != nil {
+			t.Fatalf("unexpected error for '%s': %v", test.msg, err)
+		}
+	}
+
+	expected := []string{
+		"❌You must be a moderator or editor to use this command",
+		"✅The prefix is now ?",
+		"🐒 The prefix is ?",
+		"✅The prefix is now !",
+	}
+	if !slices.Equal(sender.responses, expected) {
+		t.Errorf("expected %q, got %q", expected, sender.responses)
+	}
+}
+
+func TestJoinPartOtherChannels(t *testing.T) {
+	db := newTestDB(t)
+	sender := &MockSender{}
+	cfg := &config.Config{Prefix: "!"}
+	chatter := types.Chatter{ID: "2", Name: "chatter"}
+	for _, msg := range []string{"!join other", "!join channel other", "!part channel other"} {
+		message := &types.Message{Message: msg, Channel: "channel", RoomID: "1", DB: db, Cfg: cfg, Chatter: chatter}
+		err := HandleCommands(message, sender, cfg)
+		if err != nil {
+			t.Fatalf("unexpected error for '%s': %v", msg, err)
+		}
+	}
+
+	expected := []string{
+		"🐒 Usage: " + join.Usage,
+		roleDeniedMessage(types.RoleBotAdmin),
+		roleDeniedMessage(types.RoleBotAdmin),
+	}
+	if !slices.Equal(sender.responses, expected) {
+		t.Errorf("expected %q, got %q", expected, sender.responses)
+	}
+}
+
+func TestExploreStats(t *testing.T) {
+	db := newTestDB(t)
+	_, err := db.Exec("INSERT INTO rpg_user_item (user_id, rpg_item_id, amount) SELECT '1', id, 42 FROM rpg_item WHERE name = 'buttinho'")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Helix doesn't know any users, only the ones in the database are found
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data":[]}`))
+	}))
+	t.Cleanup(server.Close)
+	helix := twitchapi.NewClient("clientid", twitchapi.StaticToken("token"))
+	helix.BaseURL = server.URL
+	helix.HTTPClient = server.Client()
+	resolver := users.NewResolver(helix, users.DefaultTTL)
+
+	sender := &MockSender{}
+	for _, user := range []TwitchUser{"", "@Channel", "nobody"} {
+		message := &types.Message{Channel: "channel", RoomID: "1", DB: db, Users: resolver,
+			Chatter: types.Chatter{ID: "2", Name: "chatter"}, Args: &exploreStatsArgs{user}}
+		err = exploreStats.Execute(message, sender, nil)
+		if err != nil {
+			t.Fatalf("unexpected error for '%s': %v", user, err)
+		}
+	}
+
+	expected := []string{
+		"🐒 chatter has 0 buttinho",
+		"🐒 channel has 42 buttinho",
+		"❌User 'nobody' not found",
+	}
+	if !slices.Equal(sender.responses, expected) {
+		t.Errorf("expected %q, got %q", expected, sender.responses)
+	}
+}
+
+func TestCooldownOverride(t *testing.T) {
+	db := newTestDB(t)
+	sender := &MockSender{}
+	run := func(cmd types.Command, args interface{}) {
+		message := &types.Message{Channel: "test", RoomID: "1", DB: db, Args: args, Chatter: types.Chatter{IsMod: true}}
+		err := cmd.Execute(message, sender, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	run(cooldown, &cooldownArgs{"explore stats", "channel", 60})
+	run(cooldown, &cooldownArgs{"e", "User", 1200})
+	run(cooldown, &cooldownArgs{"explore", "channel", 1})
+	run(cooldown, &cooldownArgs{"explore", "global", 60})
+	run(help, &helpArgs{[]string{"explore", "stats"}})
+	run(help, &helpArgs{[]string{"explore"}})
+
+	err := func() error {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		err = database.InsertCustomCommand(tx, "1", "discord", "https://discord.gg/monkebot")
+		if err != nil {
+			return err
+		}
+		return tx.Commit()
+	}()
+	if err != nil {
+		t.Fatal(err)
+	}
+	run(cooldown, &cooldownArgs{"Discord", "user", 30})
+	run(cooldown, &cooldownArgs{"discord", "channel", 1})
+	run(cooldown, &cooldownArgs{"unknown", "channel", 60})
+	run(help, &helpArgs{[]string{"discord"}})
+
+	expected := []string{
+		"✅The channel cooldown of explore stats is now 60s",
+		"✅The user cooldown of explore is now 1200s",
+		fmt.Sprintf("❌The channel cooldown of explore must be from %d to 86400 seconds", explore.ChannelCooldown),
+		"❌Unknown cooldown 'global', it must be channel or user",
+		fmt.Sprintf("🐒 Usage: %s ● Cooldown: 60s, %ds per user", exploreStats.Usage, exploreStats.UserCooldown),
+		fmt.Sprintf("🐒 Usage: explore ● Cooldown: %ds, 1200s per user ● Subcommands: stats ● For help with one: help explore <subcommand>", explore.ChannelCooldown),
+		"✅The user cooldown of discord is now 30s",
+		fmt.Sprintf("❌The channel cooldown of discord must be from %d to 86400 seconds", customCommandChannelCooldown),
+		"❌Unknown command 'unknown'",
+		fmt.Sprintf("🐒 discord is a custom command of the channel ● Cooldown: %ds, 30s per user", customCommandChannelCooldown),
+	}
+	if !slices.Equal(sender.responses, expected) {
+		t.Errorf("expected %q, got %q", expected, sender.responses)
+	}
+}
+
+func TestRequiredRoles(t *testing.T) {
+	var check func(cmds []types.Command)
+	check = func(cmds []types.Command) {
+		for _, cmd := range cmds {
+			if !slices.Contains(types.Roles, cmd.RequiredRole) {
+				t.Errorf("command '%s' has unknown role '%s'", cmd.Name, cmd.RequiredRole)
+			}
+			check(cmd.Subcommands)
+		}
+	}
+	check(Commands)
+
+	db := newTestDB(t)
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	err = database.InsertUsers(tx, false, struct{ ID, Name string }{"2", "admin"}, struct{ ID, Name string }{"3", "vip"},
+		struct{ ID, Name string }{"4", "editor"}, struct{ ID, Name string }{"5", "trusted"}, struct{ ID, Name string }{"7", "typo"})
+	if err == nil {
+		err = database.UpdateUserPermission(tx, "2", "admin")
+	}
+	if err == nil {
+		_, err = database.InsertChannelRole(tx, "1", "4", "editor")
+	}
+	if err == nil {
+		_, err = database.InsertChannelRole(tx, "1", "5", "trusted")
+	}
+	if err == nil {
+		_, err = database.InsertChannelRole(tx, "1", "7", "moderator")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		chatter  types.Chatter
+		role     types.Role
+		expected bool
+		roomID   string
+	}{
+		{types.Chatter{ID: "3", IsVIP: true}, types.RoleEveryone, true, "1"},
+		{types.Chatter{ID: "3", IsVIP: true}, types.RoleVIP, true, "1"},
+		{types.Chatter{ID: "3", IsVIP: true}, types.RoleMod, false, "1"},
+		{types.Chatter{ID: "3", IsBroadcaster: true}, types.RoleMod, true, "1"},
+		{types.Chatter{ID: "3", IsBroadcaster: true}, types.RoleBotAdmin, false, "1"},
+		// bot admins have every role, in every channel
+		{types.Chatter{ID: "2"}, types.RoleBroadcaster, true, "1"},
+		{types.Chatter{ID: "2"}, types.RoleBotAdmin, true, "1"},
+		// users that aren't in the database yet
+		{types.Chatter{ID: "6"}, types.RoleVIP, false, "1"},
+		// editors can do what mods can, only in the channel they were given the role
+		{types.Chatter{ID: "4"}, types.RoleMod, true, "1"},
+		{types.Chatter{ID: "4"}, types.RoleEditor, true, "1"},
+		{types.Chatter{ID: "4"}, types.RoleBroadcaster, false, "1"},
+		{types.Chatter{ID: "4"}, types.RoleMod, false, "2"},
+		{types.Chatter{ID: "5"}, types.RoleTrusted, true, "1"},
+		{types.Chatter{ID: "5"}, types.RoleEditor, false, "1"},
+		{types.Chatter{ID: "3", IsMod: true}, types.RoleTrusted, true, "1"},
+		{types.Chatter{ID: "3", IsMod: true}, types.RoleEditor, true, "1"},
+		// unknown roles fail closed, even for bot admins
+		{types.Chatter{ID: "2"}, types.Role("moderator"), false, "1"},
+		{types.Chatter{ID: "3", IsBroadcaster: true}, types.Role(""), false, "1"},
+		{types.Chatter{ID: "7"}, types.RoleVIP, false, "1"},
+	}
+	for _, test := range tests {
+		allowed, err := hasRole(tx, &types.Message{Chatter: test.chatter, RoomID: test.roomID}, test.role)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if allowed != test.expected {
+			t.Errorf("expected %+v to have role %s: %t, got %t", test.chatter, test.role, test.expected, allowed)
+		}
+	}
+}
+
+func TestHandleCommandsRole(t *testing.T) {
+	db := newTestDB(t)
+	cfg := &config.Config{Prefix: "!"}
+	sender := &MockSender{}
+	chatter, mod := types.Chatter{ID: "2", Name: "chatter"}, types.Chatter{ID: "3", Name: "mod", IsMod: true}
+	// the denial is on the chatter's cooldown, but doesn't put the command on cooldown for the mod
+	for _, caller := range []types.Chatter{chatter, chatter, mod} {
+		message := &types.Message{Message: "!disable butt", Channel: "channel", RoomID: "1", DB: db, Cfg: cfg, Chatter: caller}
+		err := HandleCommands(message, sender, cfg)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	expected := []string{"❌You must be a moderator or editor to use this command", "✅Disabled command 'butt'"}
+	if !slices.Equal(sender.responses, expected) {
+		t.Errorf("expected %q, got %q", expected, sender.responses)
+	}
+}
+
+func TestRoleList(t *testing.T) {
+	db := newTestDB(t)
+	err := func() error {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		err = database.InsertUsers(tx, false, struct{ ID, Name string }{"2", "bob"}, struct{ ID, Name string }{"3", "carol"},
+			struct{ ID, Name string }{"4", "dave"})
+		if err != nil {
+			return err
+		}
+		for _, channelRole := range []struct{ userID, role string }{{"3", "editor"}, {"2", "editor"}, {"4", "trusted"}} {
+			_, err = database.InsertChannelRole(tx, "1", channelRole.userID, channelRole.role)
+			if err != nil {
+				return err
+			}
+		}
+		return tx.Commit()
+	}()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sender := &MockSender{}
+	err = roleList.Execute(&types.Message{Channel: "channel", RoomID: "1", DB: db}, sender, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = roleAdd.Execute(&types.Message{Channel: "channel", RoomID: "1", DB: db, Args: &roleArgs{"bob", "admin"}}, sender, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"🐒 editor: bob, carol ● trusted: dave", "❌Unknown role 'admin', it must be one of: trusted, editor"}
+	if !slices.Equal(sender.responses, expected) {
+		t.Errorf("expected %q, got %q", expected, sender.responses)
+	}
+}
@@ -0,0 +1,42 @@
+package command
+
+import (
+	"sync"
+	"time"
+)
+
+// confirmations keeps track of destructive actions waiting to be confirmed, like forgetme
+type confirmations struct {
+	timeout time.Duration
+
+	mu      sync.Mutex
+	pending map[string]time.Time
+}
+
+func newConfirmations(timeout time.Duration) *confirmations {
+	return &confirmations{timeout: timeout, pending: make(map[string]time.Time)}
+}
+
+// request starts waiting for the action identified by key to be confirmed
+func (c *confirmations) request(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for k, expiresAt := range c.pending {
+		if now.After(expiresAt) {
+			delete(c.pending, k)
+		}
+	}
+	c.pending[key] = now.Add(c.timeout)
+}
+
+// confirm returns true if key was requested less than timeout ago, and stops waiting for it
+func (c *confirmations) confirm(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expiresAt, ok := c.pending[key]
+	delete(c.pending, key)
+	return ok && time.Now().Before(expiresAt)
+}
@@ -0,0 +1,28 @@
+package command
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConfirmations(t *testing.T) {
+	c := newConfirmations(time.Hour)
+
+	if c.confirm("1") {
+		t.Error("expected confirming without a request to fail")
+	}
+
+	c.request("1")
+	if !c.confirm("1") {
+		t.Error("expected the request to be confirmed")
+	}
+	if c.confirm("1") {
+		t.Error("expected a request to be confirmed only once")
+	}
+
+	c.timeout = 0
+	c.request("2")
+	if c.confirm("2") {
+		t.Error("expected an expired request not to be confirmed")
+	}
+}
@@ -3,6 +3,7 @@ package command
 import (
 	"database/sql"
 	"fmt"
+	"strings"
 
 	"github.com/rs/zerolog/log"
 )
@@ -20,27 +21,42 @@ func init() {
 	}
 
 	for _, command := range Commands {
-		optoutOptions[command.Name] = func(tx *sql.Tx, userID string, optOut bool) error {
-			result, err := tx.Exec(`
-				UPDATE user_command_data SET opted_out = ?
-				WHERE user_id = ? AND command_id = (
-					SELECT id FROM command WHERE name = ?
-				)`, optOut, userID, command.Name)
-			if err != nil {
-				return err
+		allNames := commandNames(command)
+		for _, name := range allNames {
+			// opting out of a command includes its subcommands
+			var names []string
+			for _, other := range allNames {
+				if other == name || strings.HasPrefix(other, name+" ") {
+					names = append(names, other)
+				}
 			}
 
-			rowsAffected, err := result.RowsAffected()
-			if err != nil {
-				return err
+			optoutOptions[name] = func(tx *sql.Tx, userID string, optOut bool) error {
+				args := []interface{}{optOut, userID}
+				for _, name := range names {
+					args = append(args, name)
+				}
+				result, err := tx.Exec(fmt.Sprintf(`
+					UPDATE user_command_data SET opted_out = ?
+					WHERE user_id = ? AND command_id IN (
+						SELECT id FROM command WHERE name IN (%s)
+					)`, strings.Repeat("?,", len(names)-1)+"?"), args...)
+				if err != nil {
+					return err
+				}
+
+				rowsAffected, err := result.RowsAffected()
+				if err != nil {
+					return err
+				}
+
+				if rowsAffected != int64(len(names)) {
+					return fmt.Errorf("invalid number of rows affected: %d", rowsAffected)
+				}
+
+				log.Debug().Str("user_id", userID).Str("command", name).Bool("opted_out", optOut).Msg("updated opt out")
+				return nil
 			}
-
-			if rowsAffected != 1 {
-				return fmt.Errorf("invalid number of rows affected: %d", rowsAffected)
-			}
-
-			log.Debug().Str("user_id", userID).Str("command", command.Name).Bool("opted_out", optOut).Msg("updated opt out")
-			return nil
 		}
 	}
 }
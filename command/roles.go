@@ -0,0 +1,86 @@
+package command
+
+import (
+	"database/sql"
+	"fmt"
+	"monkebot/database"
+	"monkebot/types"
+	"slices"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Returns whether the chatter has the role or a more privileged one in the message's channel, from twitch's badges or
+// the roles given by the broadcaster. Bot admins have every role.
+// Unknown roles, like a typo in RequiredRole, are denied to everyone.
+func hasRole(tx *sql.Tx, message *types.Message, role types.Role) (bool, error) {
+	requiredRank := roleRank(role)
+	if requiredRank < 0 {
+		log.Error().Str("role", string(role)).Msg("denied unknown role")
+		return false, nil
+	}
+	if roleRank(chatterRole(message)) >= requiredRank {
+		return true, nil
+	}
+
+	channelRoles, err := database.SelectUserChannelRoles(tx, message.RoomID, message.Chatter.ID)
+	if err != nil {
+		return false, err
+	}
+	for _, channelRole := range channelRoles {
+		if roleRank(types.Role(channelRole)) >= requiredRank {
+			return true, nil
+		}
+	}
+
+	isAdmin, err := database.SelectIsUserAdmin(tx, message.Chatter.ID)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to check if %s is a bot admin: %w", message.Chatter.Name, err)
+	}
+	return isAdmin, nil
+}
+
+// The most privileged role the chatter has from twitch's badges
+func chatterRole(message *types.Message) types.Role {
+	switch {
+	case message.Chatter.IsBroadcaster:
+		return types.RoleBroadcaster
+	case message.Chatter.IsMod:
+		return types.RoleMod
+	case message.Chatter.IsVIP:
+		return types.RoleVIP
+	}
+	return types.RoleEveryone
+}
+
+// Returns -1 for roles that aren't in types.Roles
+func roleRank(role types.Role) int {
+	// editors manage the bot like mods, without being mods
+	if role == types.RoleEditor {
+		role = types.RoleMod
+	}
+	return slices.Index(types.Roles, role)
+}
+
+// The reply to users who don't have the role a command requires
+func roleDeniedMessage(role types.Role) string {
+	var who string
+	switch role {
+	case types.RoleVIP:
+		who = "a VIP"
+	case types.RoleTrusted:
+		who = "trusted in the channel"
+	case types.RoleMod, types.RoleEditor:
+		who = "a moderator or editor"
+	case types.RoleBroadcaster:
+		who = "the broadcaster"
+	case types.RoleBotAdmin:
+		who = "a bot admin"
+	default:
+		who = string(role)
+	}
+	return fmt.Sprintf("❌You must be %s to use this command", who)
+}
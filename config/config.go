@@ -9,7 +9,8 @@ import (
 type DBConfig struct {
 	Driver         string `json:"Driver"`
 	DataSourceName string `json:"DataSourceName"`
-	Version        int    `json:"Version"` // used to keep track of migrations. 0 means the tables were not created yet.
+	// Deprecated: migrations are tracked in the schema_migrations table. Only read once to import the version of databases created before it.
+	Version int `json:"Version,omitempty"`
 }
 
 type ExplorationResult struct {
@@ -66,6 +67,7 @@ func MarshalConfig(cfg *Config) ([]byte, error) {
 func ConfigTemplateJSON() ([]byte, error) {
 	cfg := Config{
 		InitialChannels: []string{"hash_table"},
+		TwitchToken:     "YOUR_TWITCH_TOKEN_HERE",
 		ClientSecret:    "YOUR_CLIENT_SECRET_HERE",
 		RefreshToken:    "YOUR_REFRESH_TOKEN_HERE",
 		Prefix:          "!",
@@ -76,7 +78,6 @@ func ConfigTemplateJSON() ([]byte, error) {
 		DBConfig: DBConfig{
 			Driver:         "sqlite3",
 			DataSourceName: "file:data.db",
-			Version:        0,
 		},
 		RPGConfig: RPGConfig{ExplorationResults: []ExplorationResult{
 			{ResultType: "VeryPositive", Message: "You have gained gold!"},
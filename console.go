@@ -0,0 +1,97 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"monkebot/command"
+	"monkebot/config"
+	"monkebot/database"
+	"monkebot/monkebot"
+	"monkebot/platform"
+	"monkebot/twitchapi"
+	"monkebot/types"
+	"os"
+	"slices"
+	"time"
+)
+
+// seeds the commands, the console channel and chatter so commands can run without Helix lookups
+func seedConsoleDB(db *sql.DB, cfg *config.Config, channel types.Chatter, chatter types.Chatter) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	hasCommands, err := database.SelectHasCommands(tx)
+	if err != nil {
+		return err
+	}
+	cmdNames := command.Names()
+	if !hasCommands {
+		err = database.InsertCommands(tx, cmdNames...)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, user := range []types.Chatter{channel, chatter} {
+		var exists bool
+		err = tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM "user" WHERE id = ?)`, user.ID).Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("failed to check if user %s exists: %w", user.Name, err)
+		}
+		if exists {
+			continue
+		}
+
+		err = database.InsertUsers(tx, user == channel, struct{ ID, Name string }{user.ID, user.Name})
+		if err != nil {
+			return err
+		}
+
+		if slices.Contains(cfg.AdminUsernames, user.Name) {
+			err = database.UpdateUserPermission(tx, user.ID, "admin")
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	var hasChannelCommands bool
+	err = tx.QueryRow("SELECT EXISTS(SELECT 1 FROM user_command WHERE user_id = ?)", channel.ID).Scan(&hasChannelCommands)
+	if err != nil {
+		return fmt.Errorf("failed to check for channel commands: %w", err)
+	}
+	if !hasChannelCommands {
+		err = database.InsertUserCommands(tx, channel.ID, cmdNames...)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = database.UpdateIsBotJoined(tx, true, channel.ID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// runs the bot reading chat messages from stdin and printing responses to stdout
+func runConsole(cfg config.Config, db *sql.DB, channel types.Chatter, chatter types.Chatter, shutdownTimeout time.Duration) error {
+	err := seedConsoleDB(db, &cfg, channel, chatter)
+	if err != nil {
+		return fmt.Errorf("failed to seed console database: %w", err)
+	}
+
+	console := platform.NewConsole(os.Stdin, os.Stdout, channel, chatter)
+	helix := twitchapi.NewClient(cfg.ClientID, twitchapi.StaticToken(cfg.TwitchToken))
+	// a single worker, since there's only one channel
+	mb, err := monkebot.NewMonkebot(cfg, db, console, helix, monkebot.DispatcherOptions{Workers: 1, QueueSize: 100})
+	if err != nil {
+		return fmt.Errorf("failed to initialize monkebot: %w", err)
+	}
+
+	return run(mb, shutdownTimeout)
+}
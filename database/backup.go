@@ -0,0 +1,471 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+var ErrSnapshotUnsupported = errors.New("snapshots are only supported on sqlite, use pg_dump or a JSON export instead")
+
+// Snapshot writes a consistent copy of the database to path with VACUUM INTO, which is safe while the bot is running.
+// The file at path must not exist yet.
+func Snapshot(db *sql.DB, dialect Dialect, path string) error {
+	if dialect.Driver != SQLite.Driver {
+		return ErrSnapshotUnsupported
+	}
+
+	_, err := db.Exec("VACUUM INTO ?", path)
+	if err != nil {
+		return fmt.Errorf("failed to write snapshot to %s: %w", path, err)
+	}
+	return nil
+}
+
+const snapshotPrefix = "monkebot-"
+
+// RunSnapshots writes a snapshot to dir every interval until ctx is done, keeping only the newest keep snapshots
+func RunSnapshots(ctx context.Context, db *sql.DB, dialect Dialect, dir string, interval time.Duration, keep int) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			path := filepath.Join(dir, snapshotPrefix+time.Now().Format("20060102-150405")+".db")
+			err := Snapshot(db, dialect, path)
+			if err != nil {
+				log.Err(err).Str("path", path).Msg("scheduled snapshot failed")
+				continue
+			}
+			log.Info().Str("path", path).Msg("saved scheduled snapshot")
+
+			err = removeOldSnapshots(dir, keep)
+			if err != nil {
+				log.Err(err).Str("dir", dir).Msg("failed to remove old snapshots")
+			}
+		}
+	}
+}
+
+// snapshot names sort by the time they were taken
+func removeOldSnapshots(dir string, keep int) error {
+	paths, err := filepath.Glob(filepath.Join(dir, snapshotPrefix+"*.db"))
+	if err != nil {
+		return err
+	}
+	slices.Sort(paths)
+
+	for len(paths) > keep {
+		err = os.Remove(paths[0])
+		if err != nil {
+			return err
+		}
+		log.Debug().Str("path", paths[0]).Msg("removed old snapshot")
+		paths = paths[1:]
+	}
+	return nil
+}
+
+// BotData is the bot's data in a portable format. Permissions, commands and items are referenced by name
+// instead of id, so it can be imported into another database, even one using a different driver.
+type BotData struct {
+	// SchemaVersion is the latest migration applied to the exported database
+	SchemaVersion   int                  `json:"SchemaVersion"`
+	ExportedAt      time.Time            `json:"ExportedAt"`
+	Permissions     []PermissionData     `json:"Permissions"`
+	Users           []UserData           `json:"Users"`
+	ChannelCommands []ChannelCommandData `json:"ChannelCommands"`
+	UserCommands    []UserCommandData    `json:"UserCommands"`
+	RPGItems        []RPGItemData        `json:"RPGItems"`
+	RPGInventories  []RPGInventoryData   `json:"RPGInventories"`
+	CustomCommands  []CustomCommandData  `json:"CustomCommands"`
+	CommandCounters []CommandCounterData `json:"CommandCounters"`
+	ChannelRoles    []ChannelRoleData    `json:"ChannelRoles"`
+}
+
+type PermissionData struct {
+	Name       string `json:"Name"`
+	IsIgnored  bool   `json:"IsIgnored"`
+	IsBotAdmin bool   `json:"IsBotAdmin"`
+}
+
+type UserData struct {
+	ID          string `json:"ID"`
+	Name        string `json:"Name"`
+	Permission  string `json:"Permission"`
+	BotIsJoined bool   `json:"BotIsJoined"`
+	// empty if the channel uses the default prefix
+	Prefix string `json:"Prefix,omitempty"`
+}
+
+// a command's state in a channel
+type ChannelCommandData struct {
+	ChannelID string `json:"ChannelID"`
+	Command   string `json:"Command"`
+	IsEnabled bool   `json:"IsEnabled"`
+	LastUsed  int64  `json:"LastUsed"`
+	// nil if the channel uses the command's default cooldown
+	ChannelCooldown *int `json:"ChannelCooldown,omitempty"`
+	UserCooldown    *int `json:"UserCooldown,omitempty"`
+}
+
+// a command's state for a chatter, including opt-outs
+type UserCommandData struct {
+	UserID   string `json:"UserID"`
+	Command  string `json:"Command"`
+	LastUsed int64  `json:"LastUsed"`
+	OptedOut bool   `json:"OptedOut"`
+}
+
+type RPGItemData struct {
+	Name        string `json:"Name"`
+	Description string `json:"Description"`
+}
+
+type RPGInventoryData struct {
+	UserID string `json:"UserID"`
+	Item   string `json:"Item"`
+	Amount int    `json:"Amount"`
+}
+
+type CustomCommandData struct {
+	ChannelID       string `json:"ChannelID"`
+	Name            string `json:"Name"`
+	Response        string `json:"Response"`
+	IsEnabled       bool   `json:"IsEnabled"`
+	ChannelCooldown *int   `json:"ChannelCooldown,omitempty"`
+	UserCooldown    *int   `json:"UserCooldown,omitempty"`
+}
+
+// the ${count} of a command's responses in a channel
+type CommandCounterData struct {
+	ChannelID string `json:"ChannelID"`
+	Name      string `json:"Name"`
+	Count     int    `json:"Count"`
+}
+
+// a role given to a user in a channel
+type ChannelRoleData struct {
+	ChannelID string `json:"ChannelID"`
+	UserID    string `json:"UserID"`
+	Role      string `json:"Role"`
+}
+
+// ExportData reads the bot's data from the database
+func ExportData(tx *sql.Tx) (*BotData, error) {
+	data := &BotData{ExportedAt: time.Now().UTC()}
+
+	applied, err := SelectAppliedMigrations(tx)
+	if err != nil {
+		return nil, err
+	}
+	if len(applied) > 0 {
+		data.SchemaVersion = applied[len(applied)-1].Version
+	}
+
+	err = selectRows(tx, "SELECT name, is_ignored, is_bot_admin FROM permission ORDER BY id", func(rows *sql.Rows) error {
+		var permission PermissionData
+		err := rows.Scan(&permission.Name, &permission.IsIgnored, &permission.IsBotAdmin)
+		data.Permissions = append(data.Permissions, permission)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to export permissions: %w", err)
+	}
+
+	err = selectRows(tx, `
+		SELECT u.id, u.name, p.name, u.bot_is_joined, COALESCE(u.prefix, '')
+		FROM "user" u
+		INNER JOIN permission p ON p.id = u.permission_id
+		ORDER BY u.id`, func(rows *sql.Rows) error {
+		var user UserData
+		err := rows.Scan(&user.ID, &user.Name, &user.Permission, &user.BotIsJoined, &user.Prefix)
+		data.Users = append(data.Users, user)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to export users: %w", err)
+	}
+
+	err = selectRows(tx, `
+		SELECT uc.user_id, c.name, uc.is_enabled, uc.last_used, uc.channel_cooldown, uc.user_cooldown
+		FROM user_command uc
+		INNER JOIN command c ON c.id = uc.command_id
+		ORDER BY uc.user_id, c.name`, func(rows *sql.Rows) error {
+		var channelCommand ChannelCommandData
+		err := rows.Scan(&channelCommand.ChannelID, &channelCommand.Command, &channelCommand.IsEnabled, &channelCommand.LastUsed,
+			&channelCommand.ChannelCooldown, &channelCommand.UserCooldown)
+		data.ChannelCommands = append(data.ChannelCommands, channelCommand)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to export channel commands: %w", err)
+	}
+
+	err = selectRows(tx, `
+		SELECT cd.user_id, c.name, cd.last_used, cd.opted_out
+		FROM user_command_data cd
+		INNER JOIN command c ON c.id = cd.command_id
+		ORDER BY cd.user_id, c.name`, func(rows *sql.Rows) error {
+		var userCommand UserCommandData
+		err := rows.Scan(&userCommand.UserID, &userCommand.Command, &userCommand.LastUsed, &userCommand.OptedOut)
+		data.UserCommands = append(data.UserCommands, userCommand)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to export user commands: %w", err)
+	}
+
+	err = selectRows(tx, "SELECT name, description FROM rpg_item ORDER BY id", func(rows *sql.Rows) error {
+		var item RPGItemData
+		err := rows.Scan(&item.Name, &item.Description)
+		data.RPGItems = append(data.RPGItems, item)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to export rpg items: %w", err)
+	}
+
+	err = selectRows(tx, `
+		SELECT ui.user_id, i.name, ui.amount
+		FROM rpg_user_item ui
+		INNER JOIN rpg_item i ON i.id = ui.rpg_item_id
+		ORDER BY ui.user_id, i.name`, func(rows *sql.Rows) error {
+		var inventory RPGInventoryData
+		err := rows.Scan(&inventory.UserID, &inventory.Item, &inventory.Amount)
+		data.RPGInventories = append(data.RPGInventories, inventory)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to export rpg inventories: %w", err)
+	}
+
+	err = selectRows(tx, `
+		SELECT channel_id, name, response, is_enabled, channel_cooldown, user_cooldown
+		FROM custom_command
+		ORDER BY channel_id, name`, func(rows *sql.Rows) error {
+		var customCommand CustomCommandData
+		err := rows.Scan(&customCommand.ChannelID, &customCommand.Name, &customCommand.Response, &customCommand.IsEnabled,
+			&customCommand.ChannelCooldown, &customCommand.UserCooldown)
+		data.CustomCommands = append(data.CustomCommands, customCommand)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to export custom commands: %w", err)
+	}
+
+	err = selectRows(tx, "SELECT channel_id, name, count FROM command_counter ORDER BY channel_id, name", func(rows *sql.Rows) error {
+		var counter CommandCounterData
+		err := rows.Scan(&counter.ChannelID, &counter.Name, &counter.Count)
+		data.CommandCounters = append(data.CommandCounters, counter)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to export command counters: %w", err)
+	}
+
+	err = selectRows(tx, "SELECT channel_id, user_id, role FROM channel_role ORDER BY channel_id, user_id, role", func(rows *sql.Rows) error {
+		var role ChannelRoleData
+		err := rows.Scan(&role.ChannelID, &role.UserID, &role.Role)
+		data.ChannelRoles = append(data.ChannelRoles, role)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to export channel roles: %w", err)
+	}
+
+	return data, nil
+}
+
+// ImportData saves exported data in a migrated database. Existing rows are overwritten by the imported ones,
+// and permissions, commands and items that don't exist yet are created.
+func ImportData(tx *sql.Tx, data *BotData) error {
+	applied, err := SelectAppliedMigrations(tx)
+	if err != nil {
+		return err
+	}
+	if len(applied) == 0 {
+		return fmt.Errorf("the database must be migrated before importing data")
+	}
+	if version := applied[len(applied)-1].Version; data.SchemaVersion > version {
+		return fmt.Errorf("data was exported from schema version %d, which is newer than the database's version %d", data.SchemaVersion, version)
+	}
+
+	for _, permission := range data.Permissions {
+		err = upsert(tx,
+			"UPDATE permission SET is_ignored = ?, is_bot_admin = ? WHERE name = ?",
+			"INSERT INTO permission (is_ignored, is_bot_admin, name) VALUES (?, ?, ?)",
+			permission.IsIgnored, permission.IsBotAdmin, permission.Name)
+		if err != nil {
+			return fmt.Errorf("failed to import permission %s: %w", permission.Name, err)
+		}
+	}
+
+	for _, user := range data.Users {
+		_, err = tx.Exec(`
+			INSERT INTO "user" (id, name, permission_id, bot_is_joined, prefix)
+			VALUES (?, ?, (SELECT id FROM permission WHERE name = ?), ?, NULLIF(?, ''))
+			ON CONFLICT (id) DO UPDATE SET
+				name = excluded.name,
+				permission_id = excluded.permission_id,
+				bot_is_joined = excluded.bot_is_joined,
+				prefix = excluded.prefix
+			`, user.ID, user.Name, user.Permission, user.BotIsJoined, user.Prefix)
+		if err != nil {
+			return fmt.Errorf("failed to import user %s: %w", user.Name, err)
+		}
+	}
+
+	var commands []string
+	for _, channelCommand := range data.ChannelCommands {
+		commands = append(commands, channelCommand.Command)
+	}
+	for _, userCommand := range data.UserCommands {
+		commands = append(commands, userCommand.Command)
+	}
+	slices.Sort(commands)
+	for _, command := range slices.Compact(commands) {
+		_, err = tx.Exec("INSERT INTO command (name) SELECT ? WHERE NOT EXISTS (SELECT 1 FROM command WHERE name = ?)", command, command)
+		if err != nil {
+			return fmt.Errorf("failed to import command %s: %w", command, err)
+		}
+	}
+
+	for _, channelCommand := range data.ChannelCommands {
+		err = upsert(tx,
+			`UPDATE user_command SET is_enabled = ?, last_used = ?, channel_cooldown = ?, user_cooldown = ?
+				WHERE user_id = ? AND command_id = (SELECT id FROM command WHERE name = ?)`,
+			`INSERT INTO user_command (is_enabled, last_used, channel_cooldown, user_cooldown, user_id, command_id)
+				VALUES (?, ?, ?, ?, ?, (SELECT id FROM command WHERE name = ?))`,
+			channelCommand.IsEnabled, channelCommand.LastUsed, channelCommand.ChannelCooldown, channelCommand.UserCooldown,
+			channelCommand.ChannelID, channelCommand.Command)
+		if err != nil {
+			return fmt.Errorf("failed to import command %s for channel %s: %w", channelCommand.Command, channelCommand.ChannelID, err)
+		}
+	}
+
+	for _, userCommand := range data.UserCommands {
+		err = upsert(tx,
+			`UPDATE user_command_data SET last_used = ?, opted_out = ?
+				WHERE user_id = ? AND command_id = (SELECT id FROM command WHERE name = ?)`,
+			`INSERT INTO user_command_data (last_used, opted_out, user_id, command_id)
+				VALUES (?, ?, ?, (SELECT id FROM command WHERE name = ?))`,
+			userCommand.LastUsed, userCommand.OptedOut, userCommand.UserID, userCommand.Command)
+		if err != nil {
+			return fmt.Errorf("failed to import command %s for user %s: %w", userCommand.Command, userCommand.UserID, err)
+		}
+	}
+
+	for _, item := range data.RPGItems {
+		err = upsert(tx,
+			"UPDATE rpg_item SET description = ? WHERE name = ?",
+			"INSERT INTO rpg_item (description, name) VALUES (?, ?)",
+			item.Description, item.Name)
+		if err != nil {
+			return fmt.Errorf("failed to import rpg item %s: %w", item.Name, err)
+		}
+	}
+
+	for _, inventory := range data.RPGInventories {
+		err = upsert(tx,
+			`UPDATE rpg_user_item SET amount = ?
+				WHERE user_id = ? AND rpg_item_id = (SELECT id FROM rpg_item WHERE name = ?)`,
+			`INSERT INTO rpg_user_item (amount, user_id, rpg_item_id)
+				VALUES (?, ?, (SELECT id FROM rpg_item WHERE name = ?))`,
+			inventory.Amount, inventory.UserID, inventory.Item)
+		if err != nil {
+			return fmt.Errorf("failed to import %s for user %s: %w", inventory.Item, inventory.UserID, err)
+		}
+	}
+
+	for _, customCommand := range data.CustomCommands {
+		_, err = tx.Exec(`
+			INSERT INTO custom_command (channel_id, name, response, is_enabled, channel_cooldown, user_cooldown)
+			VALUES (?, ?, ?, ?, ?, ?)
+			ON CONFLICT (channel_id, name) DO UPDATE SET
+				response = excluded.response,
+				is_enabled = excluded.is_enabled,
+				channel_cooldown = excluded.channel_cooldown,
+				user_cooldown = excluded.user_cooldown
+			`, customCommand.ChannelID, customCommand.Name, customCommand.Response, customCommand.IsEnabled,
+			customCommand.ChannelCooldown, customCommand.UserCooldown)
+		if err != nil {
+			return fmt.Errorf("failed to import custom command %s for channel %s: %w", customCommand.Name, customCommand.ChannelID, err)
+		}
+	}
+
+	for _, counter := range data.CommandCounters {
+		_, err = tx.Exec(`
+			INSERT INTO command_counter (channel_id, name, count)
+			VALUES (?, ?, ?)
+			ON CONFLICT (channel_id, name) DO UPDATE SET count = excluded.count
+			`, counter.ChannelID, counter.Name, counter.Count)
+		if err != nil {
+			return fmt.Errorf("failed to import counter of %s for channel %s: %w", counter.Name, counter.ChannelID, err)
+		}
+	}
+
+	for _, role := range data.ChannelRoles {
+		_, err = InsertChannelRole(tx, role.ChannelID, role.UserID, role.Role)
+		if err != nil {
+			return fmt.Errorf("failed to import channel role for channel %s: %w", role.ChannelID, err)
+		}
+	}
+
+	log.Info().
+		Int("users", len(data.Users)).
+		Int("channelCommands", len(data.ChannelCommands)).
+		Int("userCommands", len(data.UserCommands)).
+		Int("rpgInventories", len(data.RPGInventories)).
+		Int("customCommands", len(data.CustomCommands)).
+		Int("commandCounters", len(data.CommandCounters)).
+		Int("channelRoles", len(data.ChannelRoles)).
+		Msg("imported data")
+	return nil
+}
+
+// Runs update, and insert if no rows were updated, with the same args.
+// Used for tables without a unique constraint to use ON CONFLICT with.
+func upsert(tx *sql.Tx, update string, insert string, args ...interface{}) error {
+	result, err := tx.Exec(update, args...)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected > 0 {
+		return nil
+	}
+
+	_, err = tx.Exec(insert, args...)
+	return err
+}
+
+func selectRows(tx *sql.Tx, query string, scan func(rows *sql.Rows) error, args ...interface{}) error {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		err = scan(rows)
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
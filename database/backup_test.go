@@ -0,0 +1,226 @@
+package database
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func newTestBotDB(t *testing.T) *sql.DB {
+	driver, dataSourceName := newTestDataSource(t)
+	db, err := InitDB(driver, dataSourceName, 0)
+	if err != nil {
+		t.Fatalf("failed to init database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// a channel with its own prefix, every command, a longer butt cooldown and a custom command used once,
+// a chatter who is an editor there, opted out of butt and has some buttinhos, and a banned user
+func insertTestBotData(t *testing.T, db *sql.DB) {
+	err := inTx(db, func(tx *sql.Tx) error {
+		err := InsertCommands(tx, "butt", "help", "explore")
+		if err != nil {
+			return err
+		}
+		err = InsertUsers(tx, true, struct{ ID, Name string }{"1", "channel"})
+		if err != nil {
+			return err
+		}
+		err = InsertUsers(tx, false, struct{ ID, Name string }{"2", "chatter"}, struct{ ID, Name string }{"3", "banned"})
+		if err != nil {
+			return err
+		}
+		err = InsertUserCommands(tx, "1", "butt", "help", "explore")
+		if err != nil {
+			return err
+		}
+		err = UpdateIsUserCommandEnabled(tx, false, "1", "help")
+		if err != nil {
+			return err
+		}
+		err = UpdateChannelPrefix(tx, "1", "?")
+		if err != nil {
+			return err
+		}
+		err = UpdateCommandUserCooldown(tx, "1", "butt", 60)
+		if err != nil {
+			return err
+		}
+		_, err = InsertChannelRole(tx, "1", "2", "editor")
+		if err != nil {
+			return err
+		}
+		err = UpdateUserPermission(tx, "3", "banned")
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("UPDATE user_command_data SET opted_out = true WHERE user_id = '2' AND command_id = (SELECT id FROM command WHERE name = 'butt')")
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("INSERT INTO rpg_user_item (user_id, rpg_item_id, amount) SELECT '2', id, 42 FROM rpg_item WHERE name = 'buttinho'")
+		if err != nil {
+			return err
+		}
+		err = InsertCustomCommand(tx, "1", "discord", "https://discord.gg/monkebot")
+		if err != nil {
+			return err
+		}
+		err = UpdateCustomCommandUserCooldown(tx, "1", "discord", 30)
+		if err != nil {
+			return err
+		}
+		_, err = IncrementCommandCounter(tx, "1", "discord")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("failed to insert test data: %v", err)
+	}
+}
+
+func exportTestData(t *testing.T, db *sql.DB) *BotData {
+	var data *BotData
+	err := inTx(db, func(tx *sql.Tx) error {
+		var err error
+		data, err = ExportData(tx)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("failed to export data: %v", err)
+	}
+	return data
+}
+
+func TestExportAndImportData(t *testing.T) {
+	db := newTestBotDB(t)
+	insertTestBotData(t, db)
+
+	exported := exportTestData(t, db)
+	if exported.SchemaVersion != Migrations.Migrations[len(Migrations.Migrations)-1].Version {
+		t.Errorf("expected the latest schema version, got %d", exported.SchemaVersion)
+	}
+	if len(exported.Users) != 3 || exported.Users[0].Prefix != "?" || exported.Users[2] != (UserData{"3", "banned", "banned", false, ""}) {
+		t.Errorf("unexpected users: %+v", exported.Users)
+	}
+	if len(exported.ChannelCommands) != 3 || exported.ChannelCommands[2] != (ChannelCommandData{"1", "help", false, 1726849749, nil, nil}) {
+		t.Errorf("unexpected channel commands: %+v", exported.ChannelCommands)
+	}
+	if len(exported.CustomCommands) != 1 || exported.CustomCommands[0].UserCooldown == nil || *exported.CustomCommands[0].UserCooldown != 30 ||
+		exported.CustomCommands[0] != (CustomCommandData{"1", "discord", "https://discord.gg/monkebot", true, nil, exported.CustomCommands[0].UserCooldown}) {
+		t.Errorf("unexpected custom commands: %+v", exported.CustomCommands)
+	}
+	if len(exported.CommandCounters) != 1 || exported.CommandCounters[0] != (CommandCounterData{"1", "discord", 1}) {
+		t.Errorf("unexpected command counters: %+v", exported.CommandCounters)
+	}
+	if len(exported.ChannelRoles) != 1 || exported.ChannelRoles[0] != (ChannelRoleData{"1", "2", "editor"}) {
+		t.Errorf("unexpected channel roles: %+v", exported.ChannelRoles)
+	}
+	if len(exported.RPGInventories) != 1 || exported.RPGInventories[0] != (RPGInventoryData{"2", "buttinho", 42}) {
+		t.Errorf("unexpected inventories: %+v", exported.RPGInventories)
+	}
+
+	// a new database doesn't have any commands yet, so they're created by the import
+	imported := newTestBotDB(t)
+	err := inTx(imported, func(tx *sql.Tx) error {
+		return ImportData(tx, exported)
+	})
+	if err != nil {
+		t.Fatalf("failed to import data: %v", err)
+	}
+
+	// importing again updates the existing rows instead of adding new ones
+	err = inTx(imported, func(tx *sql.Tx) error {
+		return ImportData(tx, exported)
+	})
+	if err != nil {
+		t.Fatalf("failed to import data again: %v", err)
+	}
+
+	reexported := exportTestData(t, imported)
+	reexported.ExportedAt = exported.ExportedAt
+	if !reflect.DeepEqual(exported, reexported) {
+		t.Errorf("expected imported data to match the export\nexported: %+v\nimported: %+v", exported, reexported)
+	}
+
+	exported.SchemaVersion++
+	err = inTx(imported, func(tx *sql.Tx) error {
+		return ImportData(tx, exported)
+	})
+	if err == nil {
+		t.Error("expected an error importing data from a newer schema version")
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	if testDialect.Driver != SQLite.Driver {
+		t.Skip("snapshots are only supported on sqlite")
+	}
+
+	db := newTestBotDB(t)
+	insertTestBotData(t, db)
+
+	path := filepath.Join(t.TempDir(), "snapshot.db")
+	err := Snapshot(db, testDialect, path)
+	if err != nil {
+		t.Fatalf("failed to save snapshot: %v", err)
+	}
+
+	snapshot, err := OpenDB(SQLite.Driver, "file:"+path)
+	if err != nil {
+		t.Fatalf("failed to open snapshot: %v", err)
+	}
+	defer snapshot.Close()
+	if !reflect.DeepEqual(exportTestData(t, db).Users, exportTestData(t, snapshot).Users) {
+		t.Error("expected the snapshot to have the same users")
+	}
+
+	err = Snapshot(db, testDialect, path)
+	if err == nil {
+		t.Error("expected an error saving a snapshot over an existing file")
+	}
+
+	err = Snapshot(db, Postgres, path)
+	if err != ErrSnapshotUnsupported {
+		t.Errorf("expected ErrSnapshotUnsupported, got %v", err)
+	}
+}
+
+func TestRemoveOldSnapshots(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2024, 10, 1, 0, 0, 0, 0, time.UTC)
+	for i := range 4 {
+		name := snapshotPrefix + start.Add(time.Duration(i)*time.Hour).Format("20060102-150405") + ".db"
+		err := os.WriteFile(filepath.Join(dir, name), nil, 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// not a snapshot
+	err := os.WriteFile(filepath.Join(dir, "data.db"), nil, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = removeOldSnapshots(dir, 2)
+	if err != nil {
+		t.Fatalf("failed to remove old snapshots: %v", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	expected := []string{"data.db", "monkebot-20241001-020000.db", "monkebot-20241001-030000.db"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected %v, got %v", expected, names)
+	}
+}
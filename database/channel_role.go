@@ -0,0 +1,73 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// ChannelRole is a role a user was given in a channel
+type ChannelRole struct {
+	UserID   string
+	UserName string
+	Role     string
+}
+
+// Returns the roles the user has in the channel
+func SelectUserChannelRoles(tx *sql.Tx, channelID string, userID string) ([]string, error) {
+	var roles []string
+	err := selectRows(tx, "SELECT role FROM channel_role WHERE channel_id = ? AND user_id = ? ORDER BY role", func(rows *sql.Rows) error {
+		var role string
+		err := rows.Scan(&role)
+		roles = append(roles, role)
+		return err
+	}, channelID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select channel roles of user %s: %w", userID, err)
+	}
+	return roles, nil
+}
+
+// Returns everyone with a role in the channel, sorted by role and name
+func SelectChannelRoles(tx *sql.Tx, channelID string) ([]ChannelRole, error) {
+	var roles []ChannelRole
+	err := selectRows(tx, `
+		SELECT cr.user_id, u.name, cr.role
+		FROM channel_role cr
+		INNER JOIN "user" u ON u.id = cr.user_id
+		WHERE cr.channel_id = ?
+		ORDER BY cr.role, u.name`, func(rows *sql.Rows) error {
+		var role ChannelRole
+		err := rows.Scan(&role.UserID, &role.UserName, &role.Role)
+		roles = append(roles, role)
+		return err
+	}, channelID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select channel roles: %w", err)
+	}
+	return roles, nil
+}
+
+// Returns false if the user already had the role in the channel
+func InsertChannelRole(tx *sql.Tx, channelID string, userID string, role string) (bool, error) {
+	result, err := tx.Exec(`
+		INSERT INTO channel_role (channel_id, user_id, role) VALUES (?, ?, ?)
+		ON CONFLICT (channel_id, user_id, role) DO NOTHING
+		`, channelID, userID, role)
+	if err != nil {
+		return false, fmt.Errorf("failed to insert channel role %s for user %s: %w", role, userID, err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return rowsAffected > 0, nil
+}
+
+// Returns sql.ErrNoRows if the user didn't have the role in the channel
+func DeleteChannelRole(tx *sql.Tx, channelID string, userID string, role string) error {
+	result, err := tx.Exec("DELETE FROM channel_role WHERE channel_id = ? AND user_id = ? AND role = ?", channelID, userID, role)
+	if err != nil {
+		return fmt.Errorf("failed to delete channel role %s of user %s: %w", role, userID, err)
+	}
+	return expectOneRow(result)
+}
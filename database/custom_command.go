@@ -0,0 +1,167 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// CustomCommand is a text command added to a channel from chat
+type CustomCommand struct {
+	ID        int
+	ChannelID string
+	Name      string
+	Response  string
+	IsEnabled bool
+	// cooldowns set with the cooldown command, nil for the defaults
+	ChannelCooldown *int
+	UserCooldown    *int
+}
+
+// Returns sql.ErrNoRows if the channel has no command with that name
+func SelectCustomCommand(tx *sql.Tx, channelID string, name string) (*CustomCommand, error) {
+	cmd := &CustomCommand{}
+	err := tx.QueryRow(`
+		SELECT id, channel_id, name, response, is_enabled, channel_cooldown, user_cooldown
+		FROM custom_command
+		WHERE channel_id = ? AND name = ?
+	`, channelID, name).Scan(&cmd.ID, &cmd.ChannelID, &cmd.Name, &cmd.Response, &cmd.IsEnabled, &cmd.ChannelCooldown, &cmd.UserCooldown)
+	if err != nil {
+		return nil, err
+	}
+	return cmd, nil
+}
+
+// Returns the channel's custom commands sorted by name
+func SelectCustomCommands(tx *sql.Tx, channelID string) ([]CustomCommand, error) {
+	var commands []CustomCommand
+	err := selectRows(tx, `
+		SELECT id, channel_id, name, response, is_enabled, channel_cooldown, user_cooldown
+		FROM custom_command
+		WHERE channel_id = ?
+		ORDER BY name`, func(rows *sql.Rows) error {
+		var cmd CustomCommand
+		err := rows.Scan(&cmd.ID, &cmd.ChannelID, &cmd.Name, &cmd.Response, &cmd.IsEnabled, &cmd.ChannelCooldown, &cmd.UserCooldown)
+		commands = append(commands, cmd)
+		return err
+	}, channelID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select custom commands: %w", err)
+	}
+	return commands, nil
+}
+
+func InsertCustomCommand(tx *sql.Tx, channelID string, name string, response string) error {
+	_, err := tx.Exec("INSERT INTO custom_command (channel_id, name, response) VALUES (?, ?, ?)", channelID, name, response)
+	if err != nil {
+		return fmt.Errorf("failed to insert custom command %s: %w", name, err)
+	}
+	return nil
+}
+
+// Returns sql.ErrNoRows if the channel has no command with that name
+func UpdateCustomCommandResponse(tx *sql.Tx, channelID string, name string, response string) error {
+	result, err := tx.Exec("UPDATE custom_command SET response = ? WHERE channel_id = ? AND name = ?", response, channelID, name)
+	if err != nil {
+		return fmt.Errorf("failed to update custom command %s: %w", name, err)
+	}
+	return expectOneRow(result)
+}
+
+// Returns sql.ErrNoRows if the channel has no command with that name
+func UpdateIsCustomCommandEnabled(tx *sql.Tx, enabled bool, channelID string, name string) error {
+	result, err := tx.Exec("UPDATE custom_command SET is_enabled = ? WHERE channel_id = ? AND name = ?", enabled, channelID, name)
+	if err != nil {
+		return fmt.Errorf("failed to update is_enabled of custom command %s: %w", name, err)
+	}
+	return expectOneRow(result)
+}
+
+// Returns sql.ErrNoRows if the channel has no command with that name
+func UpdateCustomCommandChannelCooldown(tx *sql.Tx, channelID string, name string, seconds int) error {
+	result, err := tx.Exec("UPDATE custom_command SET channel_cooldown = ? WHERE channel_id = ? AND name = ?", seconds, channelID, name)
+	if err != nil {
+		return fmt.Errorf("failed to update cooldown of custom command %s: %w", name, err)
+	}
+	return expectOneRow(result)
+}
+
+// Returns sql.ErrNoRows if the channel has no command with that name
+func UpdateCustomCommandUserCooldown(tx *sql.Tx, channelID string, name string, seconds int) error {
+	result, err := tx.Exec("UPDATE custom_command SET user_cooldown = ? WHERE channel_id = ? AND name = ?", seconds, channelID, name)
+	if err != nil {
+		return fmt.Errorf("failed to update user cooldown of custom command %s: %w", name, err)
+	}
+	return expectOneRow(result)
+}
+
+// Deletes the command and its counter, returns sql.ErrNoRows if the channel has no command with that name
+func DeleteCustomCommand(tx *sql.Tx, channelID string, name string) error {
+	result, err := tx.Exec("DELETE FROM custom_command WHERE channel_id = ? AND name = ?", channelID, name)
+	if err != nil {
+		return fmt.Errorf("failed to delete custom command %s: %w", name, err)
+	}
+	err = expectOneRow(result)
+	if err != nil {
+		return err
+	}
+
+	// a command added later with the same name starts counting again
+	_, err = tx.Exec("DELETE FROM command_counter WHERE channel_id = ? AND name = ?", channelID, name)
+	if err != nil {
+		return fmt.Errorf("failed to delete counter of custom command %s: %w", name, err)
+	}
+	return nil
+}
+
+func SelectIsCustomCommandOnChannelCooldown(tx *sql.Tx, customCommandID int, cooldownSeconds int) (bool, error) {
+	var lastUsed int64
+	err := tx.QueryRow("SELECT last_used FROM custom_command WHERE id = ?", customCommandID).Scan(&lastUsed)
+	if err != nil {
+		return false, fmt.Errorf("failed to select custom command cooldown: %w", err)
+	}
+	return time.Now().Before(time.Unix(lastUsed, 0).Add(time.Duration(cooldownSeconds) * time.Second)), nil
+}
+
+// Users that never used the command don't have custom_command_data, and aren't on cooldown
+func SelectIsCustomCommandOnUserCooldown(tx *sql.Tx, customCommandID int, userID string, cooldownSeconds int) (bool, error) {
+	var lastUsed int64
+	err := tx.QueryRow("SELECT last_used FROM custom_command_data WHERE custom_command_id = ? AND user_id = ?", customCommandID, userID).Scan(&lastUsed)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to select custom command user cooldown: %w", err)
+	}
+	return time.Now().Before(time.Unix(lastUsed, 0).Add(time.Duration(cooldownSeconds) * time.Second)), nil
+}
+
+// Updates the channel and user cooldowns of a custom command
+func UpdateCustomCommandLastUsed(tx *sql.Tx, customCommandID int, userID string) error {
+	now := time.Now().Unix()
+
+	_, err := tx.Exec("UPDATE custom_command SET last_used = ? WHERE id = ?", now, customCommandID)
+	if err != nil {
+		return fmt.Errorf("failed to update custom command cooldown: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO custom_command_data (custom_command_id, user_id, last_used) VALUES (?, ?, ?)
+		ON CONFLICT (custom_command_id, user_id) DO UPDATE SET last_used = excluded.last_used
+	`, customCommandID, userID, now)
+	if err != nil {
+		return fmt.Errorf("failed to update custom command user cooldown: %w", err)
+	}
+	return nil
+}
+
+func expectOneRow(result sql.Result) error {
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
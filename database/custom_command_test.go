@@ -0,0 +1,109 @@
+package database
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestCustomCommands(t *testing.T) {
+	db := newTestBotDB(t)
+	insertTestBotData(t, db)
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	err = InsertCustomCommand(tx, "1", "rules", "be nice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = InsertCustomCommand(tx, "1", "rules", "be mean")
+	if err == nil {
+		t.Error("expected an error adding a command that already exists")
+	}
+
+	err = UpdateCustomCommandResponse(tx, "1", "rules", "be very nice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = UpdateIsCustomCommandEnabled(tx, false, "1", "discord")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	commands, err := SelectCustomCommands(tx, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(commands) != 2 || commands[0].Name != "discord" || commands[0].IsEnabled || commands[1].Response != "be very nice" {
+		t.Errorf("expected a disabled discord command and the updated rules command, got %+v", commands)
+	}
+
+	err = DeleteCustomCommand(tx, "1", "rules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = SelectCustomCommand(tx, "1", "rules")
+	if err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows selecting a deleted command, got %v", err)
+	}
+	for _, err := range []error{
+		UpdateCustomCommandResponse(tx, "1", "rules", "gone"),
+		UpdateIsCustomCommandEnabled(tx, true, "1", "rules"),
+		DeleteCustomCommand(tx, "1", "rules"),
+	} {
+		if err != sql.ErrNoRows {
+			t.Errorf("expected sql.ErrNoRows changing a command that doesn't exist, got %v", err)
+		}
+	}
+}
+
+func TestCustomCommandCooldowns(t *testing.T) {
+	db := newTestBotDB(t)
+	insertTestBotData(t, db)
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	custom, err := SelectCustomCommand(tx, "1", "discord")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	onCooldown, err := SelectIsCustomCommandOnChannelCooldown(tx, custom.ID, 5)
+	if err != nil || onCooldown {
+		t.Errorf("expected an unused command not to be on channel cooldown, got %t: %v", onCooldown, err)
+	}
+	onCooldown, err = SelectIsCustomCommandOnUserCooldown(tx, custom.ID, "2", 5)
+	if err != nil || onCooldown {
+		t.Errorf("expected an unused command not to be on user cooldown, got %t: %v", onCooldown, err)
+	}
+
+	err = UpdateCustomCommandLastUsed(tx, custom.ID, "2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the second use updates the existing custom_command_data
+	err = UpdateCustomCommandLastUsed(tx, custom.ID, "2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	onCooldown, err = SelectIsCustomCommandOnChannelCooldown(tx, custom.ID, 5)
+	if err != nil || !onCooldown {
+		t.Errorf("expected a used command to be on channel cooldown, got %t: %v", onCooldown, err)
+	}
+	onCooldown, err = SelectIsCustomCommandOnUserCooldown(tx, custom.ID, "2", 5)
+	if err != nil || !onCooldown {
+		t.Errorf("expected a used command to be on user cooldown, got %t: %v", onCooldown, err)
+	}
+	onCooldown, err = SelectIsCustomCommandOnUserCooldown(tx, custom.ID, "3", 5)
+	if err != nil || onCooldown {
+		t.Errorf("expected other users not to be on cooldown, got %t: %v", onCooldown, err)
+	}
+}
@@ -3,79 +3,56 @@ package database
 import (
 	"database/sql"
 	"fmt"
-	"io"
-	"monkebot/config"
+	"strings"
 	"time"
 
-	_ "github.com/ncruces/go-sqlite3/driver"
 	_ "github.com/ncruces/go-sqlite3/embed"
 	"github.com/rs/zerolog/log"
 )
 
-// Initialize the database, run needed migrations and update database config to the latest version if the miggrations succeed
-func InitDB(driver string, dataSourceName string, cfgReader io.Reader, cfgWriter io.Writer) (*sql.DB, error) {
-	db, err := sql.Open(driver, dataSourceName)
+// Initialize the database and run needed migrations.
+// legacyVersion is DBConfig.Version from the config, only used to import the version of databases created before schema_migrations
+func InitDB(driver string, dataSourceName string, legacyVersion int) (*sql.DB, error) {
+	dialect, err := DialectFor(driver)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %w", err)
+		return nil, err
 	}
 
-	err = db.Ping()
+	db, err := OpenDB(driver, dataSourceName)
 	if err != nil {
-		return nil, fmt.Errorf("failed to ping database: %w", err)
-	}
-
-	if driver == "sqlite3" {
-		pragmas := []string{
-			"PRAGMA main.page_size=8192;",
-			"PRAGMA main.cache_size=15000;",
-			"PRAGMA main.synchronous=NORMAL;",
-			"PRAGMA main.journal_mode=WAL;",
-			"PRAGMA main.temp_store=MEMORY;",
-		}
-
-		for _, p := range pragmas {
-			_, err = db.Exec(p)
-			if err != nil {
-				return nil, fmt.Errorf("failed to set pragma: %w", err)
-			}
-		}
+		return nil, err
 	}
 
-	var cfg *config.Config
-	var data []byte
-	data, err = io.ReadAll(cfgReader)
+	err = Migrate(db, dialect, &Migrations, legacyVersion)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read config: %w", err)
+		db.Close()
+		return nil, fmt.Errorf("failed to run migrations: %w", err)
 	}
 
-	cfg, err = config.LoadConfig(data)
-	if err != nil {
-		return nil, fmt.Errorf("failed to load config: %w", err)
-	}
+	return db, nil
+}
 
-	tx, err := db.Begin()
-	defer tx.Rollback()
-	if err != nil {
-		return nil, fmt.Errorf("failed to begin transaction: %w", err)
-	}
-	err = RunMigrations(tx, cfg, &Migrations)
+// Open the database and set it up for the bot without running migrations
+func OpenDB(driver string, dataSourceName string) (*sql.DB, error) {
+	dialect, err := DialectFor(driver)
 	if err != nil {
-		return nil, fmt.Errorf("failed to run migrations: %w", err)
+		return nil, err
 	}
 
-	err = tx.Commit()
-	if err != nil {
-		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	var db *sql.DB
+	if dialect.open != nil {
+		db, err = dialect.open(dataSourceName)
+	} else {
+		db, err = sql.Open(dialect.Driver, dataSourceName)
 	}
-
-	latestVer := Migrations.Migrations[len(Migrations.Migrations)-1].Version
-	data, err = config.MarshalConfig(cfg)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal config, update your config to %d manually. Error: %w", latestVer, err)
+		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
-	_, err = cfgWriter.Write(data)
+
+	err = db.Ping()
 	if err != nil {
-		return nil, fmt.Errorf("failed to write config, update your config to %d manually. Error: %w", latestVer, err)
+		db.Close()
+		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
 	return db, nil
@@ -89,7 +66,7 @@ func SelectIsUserIgnored(tx *sql.Tx, userID string) (bool, error) {
 
 	err = tx.QueryRow(`
 		SELECT p.is_ignored FROM permission p
-		INNER JOIN user u ON u.permission_id = p.id
+		INNER JOIN "user" u ON u.permission_id = p.id
 		WHERE u.id = ?
 	`, userID).Scan(&isIgnored)
 	if err != nil {
@@ -99,25 +76,36 @@ func SelectIsUserIgnored(tx *sql.Tx, userID string) (bool, error) {
 	return isIgnored, nil
 }
 
-func SelectJoinedChannels(tx *sql.Tx) ([]string, error) {
+// Returns the ids and saved names of the channels the bot is joined to
+func SelectJoinedChannels(tx *sql.Tx) ([]struct{ ID, Name string }, error) {
 	var (
 		err      error
-		channels []string
+		channels []struct{ ID, Name string }
 	)
-	rows, err := tx.Query("SELECT name FROM user WHERE bot_is_joined")
+	rows, err := tx.Query(`SELECT id, name FROM "user" WHERE bot_is_joined`)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	for rows.Next() {
-		var channel string
-		err = rows.Scan(&channel)
+		var channel struct{ ID, Name string }
+		err = rows.Scan(&channel.ID, &channel.Name)
 		if err != nil {
 			return nil, err
 		}
 		channels = append(channels, channel)
 	}
-	return channels, nil
+	return channels, rows.Err()
+}
+
+// Returns true if the commands were inserted, meaning the bot's initial setup is done
+func SelectHasCommands(tx *sql.Tx) (bool, error) {
+	var hasCommands bool
+	err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM command)").Scan(&hasCommands)
+	if err != nil {
+		return false, fmt.Errorf("failed to check for existing commands: %w", err)
+	}
+	return hasCommands, nil
 }
 
 func SelectIsUserAdmin(tx *sql.Tx, userID string) (bool, error) {
@@ -127,7 +115,7 @@ func SelectIsUserAdmin(tx *sql.Tx, userID string) (bool, error) {
 	)
 	err = tx.QueryRow(`
 		SELECT p.is_bot_admin FROM permission p
-		INNER JOIN user u ON u.permission_id = p.id
+		INNER JOIN "user" u ON u.permission_id = p.id
 		WHERE u.id = ?
 	`, userID).Scan(&isAdmin)
 	if err != nil {
@@ -164,30 +152,27 @@ func InsertCommands(tx *sql.Tx, commandNames ...string) error {
 
 // inserts the current list of commands for a user, so that admins have channel-level control over commands
 func InsertUserCommands(tx *sql.Tx, userID string, commandNames ...string) error {
-	rows, err := tx.Query("SELECT id FROM command")
+	commandIDStmt, err := tx.Prepare("SELECT id FROM command WHERE name = ?")
 	if err != nil {
-		return fmt.Errorf("failed to get command ids: %w", err)
+		return fmt.Errorf("failed to prepare command id query: %w", err)
 	}
-	defer rows.Close()
+	defer commandIDStmt.Close()
 
 	commandIDs := make([]int, len(commandNames))
-	for i := 0; rows.Next(); i++ {
-		var id int
-		err = rows.Scan(&id)
+	for i, name := range commandNames {
+		err = commandIDStmt.QueryRow(name).Scan(&commandIDs[i])
 		if err != nil {
-			return fmt.Errorf("failed to scan command ids: %w", err)
+			return fmt.Errorf("failed to get id of command '%s': %w", name, err)
 		}
-		commandIDs[i] = id
-	}
-
-	err = rows.Err()
-	if err != nil {
-		return fmt.Errorf("failed to get command ids: %w", err)
 	}
 
 	// prepared statement to check if user command already exists
 	var userCommandExistsStmt *sql.Stmt
 	userCommandExistsStmt, err = tx.Prepare("SELECT id FROM user_command WHERE user_id = ? AND command_id = ?")
+	if err != nil {
+		return fmt.Errorf("failed to prepare user command query: %w", err)
+	}
+	defer userCommandExistsStmt.Close()
 	commandExists := func(userID string, commandID int) bool {
 		var id int
 		err = userCommandExistsStmt.QueryRow(userID, commandID).Scan(&id)
@@ -202,6 +187,7 @@ func InsertUserCommands(tx *sql.Tx, userID string, commandNames ...string) error
 	if err != nil {
 		return fmt.Errorf("failed to prepare user command insert: %w", err)
 	}
+	defer userCommandInsertStmt.Close()
 	for _, commandID := range commandIDs {
 		if commandExists(userID, commandID) {
 			return fmt.Errorf("user %s already has command %d", userID, commandID)
@@ -231,34 +217,38 @@ func InsertUsers(tx *sql.Tx, joinBot bool, users ...struct{ ID, Name string }) e
 		return fmt.Errorf("failed to find user permission: %w", err)
 	}
 
-	// prepare user insert
+	// prepare user insert, a failed statement would abort the whole transaction on postgres so existing users are skipped with ON CONFLICT
 	var userInsertStmt *sql.Stmt
-	userInsertStmt, err = tx.Prepare("INSERT INTO user (id, permission_id, name, bot_is_joined) VALUES (?, ?, ?, ?)")
+	userInsertStmt, err = tx.Prepare(`INSERT INTO "user" (id, permission_id, name, bot_is_joined) VALUES (?, ?, ?, ?) ON CONFLICT (id) DO NOTHING`)
 	if err != nil {
 		return fmt.Errorf("failed to prepare user insert: %w", err)
 	}
+	defer userInsertStmt.Close()
 
 	// insert users
 	var (
-		result sql.Result
-		userID int64
+		result       sql.Result
+		rowsAffected int64
 	)
 	for _, user := range users {
 		result, err = userInsertStmt.Exec(user.ID, userPermissionID, user.Name, joinBot)
 		if err != nil {
-			log.Warn().Err(err).Str("name", user.Name).Msg("skipping insertion for user")
-			continue
+			return fmt.Errorf("failed to insert user %s: %w", user.Name, err)
 		}
-		userID, err = result.LastInsertId()
+		rowsAffected, err = result.RowsAffected()
 		if err != nil {
-			return fmt.Errorf("failed to get inserted user's id")
+			return fmt.Errorf("failed to get rows affected: %w", err)
+		}
+		if rowsAffected == 0 {
+			log.Debug().Str("id", user.ID).Str("name", user.Name).Msg("skipping insertion for existing user")
+			continue
 		}
 
 		// insert user command data for each command
 		_, err = tx.Exec(`
 			INSERT INTO user_command_data (user_id, command_id)
 			SELECT u.id, c.id
-			FROM user u
+			FROM "user" u
 			CROSS JOIN command c
 			WHERE u.id = ?
 		`, user.ID)
@@ -266,13 +256,13 @@ func InsertUsers(tx *sql.Tx, joinBot bool, users ...struct{ ID, Name string }) e
 			return fmt.Errorf("failed to insert user command data: %w", err)
 		}
 
-		log.Info().Int64("user_id", userID).Str("name", user.Name).Msg("inserted new user")
+		log.Info().Str("id", user.ID).Str("name", user.Name).Msg("inserted new user")
 	}
 
 	return nil
 }
 
-func UpdateUserPermission(tx *sql.Tx, username string, permissionName string) error {
+func UpdateUserPermission(tx *sql.Tx, userID string, permissionName string) error {
 	var (
 		err       error
 		newPermID int64
@@ -285,9 +275,9 @@ func UpdateUserPermission(tx *sql.Tx, username string, permissionName string) er
 	}
 
 	var res sql.Result
-	res, err = tx.Exec("UPDATE user SET permission_id = ? WHERE name = ?", newPermID, username)
+	res, err = tx.Exec(`UPDATE "user" SET permission_id = ? WHERE id = ?`, newPermID, userID)
 	if err != nil {
-		return fmt.Errorf("failed to update user %s: %w", username, err)
+		return fmt.Errorf("failed to update user %s: %w", userID, err)
 	}
 
 	rowsAffected, err := res.RowsAffected()
@@ -296,14 +286,64 @@ func UpdateUserPermission(tx *sql.Tx, username string, permissionName string) er
 	}
 
 	if rowsAffected != 1 {
-		return fmt.Errorf("invalid number of affected rows %d trying to update user %s's permission to %s", rowsAffected, username, permissionName)
+		return fmt.Errorf("invalid number of affected rows %d trying to update user %s's permission to %s", rowsAffected, userID, permissionName)
 	}
 
 	return nil
 }
 
+// Updates a user's name if it changed, saving the old name in user_name_history.
+// Returns false if the user isn't in the database or the name didn't change.
+func UpdateUserName(tx *sql.Tx, userID string, name string) (bool, error) {
+	var oldName string
+	err := tx.QueryRow(`SELECT name FROM "user" WHERE id = ?`, userID).Scan(&oldName)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to select name of user %s: %w", userID, err)
+	}
+
+	if oldName == name {
+		return false, nil
+	}
+
+	_, err = tx.Exec(`UPDATE "user" SET name = ? WHERE id = ?`, name, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to update name of user %s: %w", userID, err)
+	}
+
+	_, err = tx.Exec("INSERT INTO user_name_history (user_id, old_name, new_name, changed_at) VALUES (?, ?, ?, ?)", userID, oldName, name, time.Now().Unix())
+	if err != nil {
+		return false, fmt.Errorf("failed to insert name history of user %s: %w", userID, err)
+	}
+
+	log.Info().Str("id", userID).Str("oldName", oldName).Str("newName", name).Msg("user changed name")
+	return true, nil
+}
+
+// Deletes a user and everything tied to their id through ON DELETE CASCADE, like their command data, rpg items,
+// name history and, for channels, the channel's commands. Returns the user's name and whether the bot was joined to their channel,
+// or sql.ErrNoRows if the user doesn't exist.
+func DeleteUser(tx *sql.Tx, userID string) (string, bool, error) {
+	var (
+		name      string
+		wasJoined bool
+	)
+	err := tx.QueryRow(`DELETE FROM "user" WHERE id = ? RETURNING name, bot_is_joined`, userID).Scan(&name, &wasJoined)
+	if err == sql.ErrNoRows {
+		return "", false, err
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to delete user %s: %w", userID, err)
+	}
+
+	log.Info().Str("id", userID).Str("name", name).Msg("deleted user")
+	return name, wasJoined, nil
+}
+
 func UpdateIsBotJoined(tx *sql.Tx, joined bool, userIDs ...string) error {
-	stmt, err := tx.Prepare("UPDATE user SET bot_is_joined = ? WHERE id = ? ")
+	stmt, err := tx.Prepare(`UPDATE "user" SET bot_is_joined = ? WHERE id = ? `)
 	if err != nil {
 		return fmt.Errorf("failed to update is_bot_joined for user %s: %w", userIDs, err)
 	}
@@ -352,15 +392,46 @@ func UpdateIsUserCommandEnabled(tx *sql.Tx, enabled bool, channelID string, comm
 	return nil
 }
 
-func SelectUserExists(tx *sql.Tx, username string) (bool, error) {
+func SelectUserExists(tx *sql.Tx, userID string) (bool, error) {
 	var exists bool
-	err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM user WHERE name = ?)", username).Scan(&exists)
+	err := tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM "user" WHERE id = ?)`, userID).Scan(&exists)
 	if err != nil {
 		return false, fmt.Errorf("failed to select user exists: %w", err)
 	}
 	return exists, nil
 }
 
+// Returns the users with the given names, names that aren't in the database are left out
+func SelectUsersByName(tx *sql.Tx, names ...string) ([]struct{ ID, Name string }, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	args := make([]interface{}, len(names))
+	for i, name := range names {
+		args[i] = name
+	}
+
+	query := fmt.Sprintf(`SELECT id, name FROM "user" WHERE name IN (%s)`, strings.Repeat("?,", len(names)-1)+"?")
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select users by name: %w", err)
+	}
+	defer rows.Close()
+
+	var users []struct{ ID, Name string }
+	for rows.Next() {
+		var user struct{ ID, Name string }
+		err = rows.Scan(&user.ID, &user.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
+
 func SelectIsUserCommandEnabled(tx *sql.Tx, channelID string, commandName string) (bool, error) {
 	var enabled bool
 	err := tx.QueryRow(`
@@ -467,8 +538,16 @@ func UpdateUserCommandLastUsed(tx *sql.Tx, channelID string, commandName string,
 		return fmt.Errorf("invalid number of affected rows trying to update command's %s cooldown: %d", commandName, rowsAffected)
 	}
 
-	// update user command cooldown
-	result, err = tx.Exec(`
+	return updateUserCommandDataLastUsed(tx, commandName, userID, now)
+}
+
+// Updates only the user's cooldown of the command, leaving the channel's cooldown alone
+func UpdateUserCommandDataLastUsed(tx *sql.Tx, commandName string, userID string) error {
+	return updateUserCommandDataLastUsed(tx, commandName, userID, time.Now().Unix())
+}
+
+func updateUserCommandDataLastUsed(tx *sql.Tx, commandName string, userID string, now int64) error {
+	result, err := tx.Exec(`
     UPDATE user_command_data
     SET last_used = ?
     WHERE user_id = ? 
@@ -477,7 +556,7 @@ func UpdateUserCommandLastUsed(tx *sql.Tx, channelID string, commandName string,
 		return fmt.Errorf("failed to update user command's %s cooldown: %w", commandName, err)
 	}
 
-	rowsAffected, err = result.RowsAffected()
+	rowsAffected, err := result.RowsAffected()
 	if err != nil {
 		return fmt.Errorf("failed to get rows affected: %w", err)
 	}
@@ -488,3 +567,91 @@ func UpdateUserCommandLastUsed(tx *sql.Tx, channelID string, commandName string,
 
 	return nil
 }
+
+// Increments the channel's counter for the command, starting at 1, and returns the new count
+func IncrementCommandCounter(tx *sql.Tx, channelID string, commandName string) (int, error) {
+	var count int
+	err := tx.QueryRow(`
+		INSERT INTO command_counter (channel_id, name, count) VALUES (?, ?, 1)
+		ON CONFLICT (channel_id, name) DO UPDATE SET count = command_counter.count + 1
+		RETURNING count
+		`, channelID, commandName).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to increment counter of command %s: %w", commandName, err)
+	}
+	return count, nil
+}
+
+// Returns how many of the item the user has, 0 if they have none
+func SelectUserItemAmount(tx *sql.Tx, userID string, itemName string) (int, error) {
+	var amount int
+	err := tx.QueryRow(`
+		SELECT ui.amount
+		FROM rpg_user_item ui
+		INNER JOIN rpg_item i ON i.id = ui.rpg_item_id
+		WHERE ui.user_id = ? AND i.name = ?
+		`, userID, itemName).Scan(&amount)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to select user's %s: %w", itemName, err)
+	}
+	return amount, nil
+}
+
+// Returns the channel's prefix, empty if it uses the default one or isn't in the database
+func SelectChannelPrefix(tx *sql.Tx, channelID string) (string, error) {
+	var prefix sql.NullString
+	err := tx.QueryRow(`SELECT prefix FROM "user" WHERE id = ?`, channelID).Scan(&prefix)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to select prefix of channel %s: %w", channelID, err)
+	}
+	return prefix.String, nil
+}
+
+// Sets the channel's prefix, an empty prefix resets it to the default
+func UpdateChannelPrefix(tx *sql.Tx, channelID string, prefix string) error {
+	result, err := tx.Exec(`UPDATE "user" SET prefix = NULLIF(?, '') WHERE id = ?`, prefix, channelID)
+	if err != nil {
+		return fmt.Errorf("failed to update prefix of channel %s: %w", channelID, err)
+	}
+	return expectOneRow(result)
+}
+
+// Returns the command's cooldowns in the channel, in seconds, using the defaults where the channel has no override
+func SelectCommandCooldowns(tx *sql.Tx, channelID string, commandName string, defaultChannel int, defaultUser int) (int, int, error) {
+	channelCooldown, userCooldown := defaultChannel, defaultUser
+	err := tx.QueryRow(`
+		SELECT COALESCE(uc.channel_cooldown, ?), COALESCE(uc.user_cooldown, ?)
+		FROM user_command uc
+		INNER JOIN command c ON c.id = uc.command_id
+		WHERE c.name = ? AND uc.user_id = ?
+		`, defaultChannel, defaultUser, commandName, channelID).Scan(&channelCooldown, &userCooldown)
+	if err == sql.ErrNoRows {
+		return defaultChannel, defaultUser, nil
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to select cooldowns of command %s: %w", commandName, err)
+	}
+	return channelCooldown, userCooldown, nil
+}
+
+func UpdateCommandChannelCooldown(tx *sql.Tx, channelID string, commandName string, seconds int) error {
+	return updateCommandCooldown(tx, "UPDATE user_command SET channel_cooldown = ?", channelID, commandName, seconds)
+}
+
+func UpdateCommandUserCooldown(tx *sql.Tx, channelID string, commandName string, seconds int) error {
+	return updateCommandCooldown(tx, "UPDATE user_command SET user_cooldown = ?", channelID, commandName, seconds)
+}
+
+func updateCommandCooldown(tx *sql.Tx, update string, channelID string, commandName string, seconds int) error {
+	result, err := tx.Exec(update+" WHERE user_id = ? AND command_id = (SELECT id FROM command WHERE name = ?)", seconds, channelID, commandName)
+	if err != nil {
+		return fmt.Errorf("failed to update cooldown of command %s: %w", commandName, err)
+	}
+	return expectOneRow(result)
+}
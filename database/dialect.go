@@ -0,0 +1,173 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/ncruces/go-sqlite3"
+	sqlitedriver "github.com/ncruces/go-sqlite3/driver"
+)
+
+// Dialect holds what differs between the supported databases.
+// Queries and migrations are written for SQLite, using ? placeholders and quoting the user table as "user",
+// and translated by the dialect when needed.
+type Dialect struct {
+	// Driver is the database/sql driver name, the same as DBConfig.Driver
+	Driver string
+
+	// opens the database, sql.Open is used if nil
+	open             func(dataSourceName string) (*sql.DB, error)
+	translate        func(stmt string) string
+	tableExistsQuery string
+}
+
+var SQLite = Dialect{
+	Driver:           "sqlite3",
+	open:             openSQLite,
+	tableExistsQuery: "SELECT EXISTS(SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = ?)",
+}
+
+// set on every connection, since most pragmas only apply to the connection that runs them
+var sqlitePragmas = []string{
+	"PRAGMA main.page_size=8192;",
+	"PRAGMA main.cache_size=15000;",
+	"PRAGMA main.synchronous=NORMAL;",
+	"PRAGMA main.journal_mode=WAL;",
+	"PRAGMA main.temp_store=MEMORY;",
+	// off by default, without it ON DELETE CASCADE does nothing
+	"PRAGMA foreign_keys=ON;",
+}
+
+func openSQLite(dataSourceName string) (*sql.DB, error) {
+	return sqlitedriver.Open(sqliteDataSourceName(dataSourceName), func(conn *sqlite3.Conn) error {
+		for _, pragma := range sqlitePragmas {
+			err := conn.Exec(pragma)
+			if err != nil {
+				return fmt.Errorf("failed to set pragma: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// Messages are handled concurrently, so transactions take the write lock when they begin and wait for each other,
+// instead of failing with SQLITE_BUSY when two of them try to upgrade from a read to a write lock
+func sqliteDataSourceName(dataSourceName string) string {
+	if !strings.HasPrefix(dataSourceName, "file:") || strings.Contains(dataSourceName, "_txlock=") {
+		return dataSourceName
+	}
+
+	if strings.Contains(dataSourceName, "?") {
+		return dataSourceName + "&_txlock=immediate"
+	}
+	return dataSourceName + "?_txlock=immediate"
+}
+
+// Postgres uses the pgx driver registered as "postgres", which rewrites ? placeholders to $1, $2...
+// so queries don't need to be changed
+var Postgres = Dialect{
+	Driver:           "postgres",
+	translate:        translatePostgres,
+	tableExistsQuery: "SELECT EXISTS(SELECT 1 FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = ?)",
+}
+
+func DialectFor(driver string) (Dialect, error) {
+	switch driver {
+	case SQLite.Driver:
+		return SQLite, nil
+	case Postgres.Driver:
+		return Postgres, nil
+	}
+	return Dialect{}, fmt.Errorf("unsupported database driver '%s', use %s or %s", driver, SQLite.Driver, Postgres.Driver)
+}
+
+// Translate rewrites a migration statement for the dialect
+func (d Dialect) Translate(stmt string) string {
+	if d.translate == nil {
+		return stmt
+	}
+	return d.translate(stmt)
+}
+
+var (
+	// like an INTEGER PRIMARY KEY in SQLite, ids are generated when they're not inserted
+	postgresIdentity = regexp.MustCompile(`INTEGER (NOT NULL )?PRIMARY KEY( AUTOINCREMENT)?`)
+	// SQLite integers are 64 bits, postgres' INTEGER is 32
+	postgresInteger = regexp.MustCompile(`\bINTEGER\b`)
+)
+
+func translatePostgres(stmt string) string {
+	stmt = postgresIdentity.ReplaceAllString(stmt, "BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY")
+	return postgresInteger.ReplaceAllString(stmt, "BIGINT")
+}
+
+func init() {
+	sql.Register(Postgres.Driver, postgresDriver{})
+}
+
+// wraps pgx's driver to rewrite ? placeholders
+type postgresDriver struct{}
+
+func (postgresDriver) Open(name string) (driver.Conn, error) {
+	conn, err := stdlib.GetDefaultDriver().Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return postgresConn{conn.(*stdlib.Conn)}, nil
+}
+
+type postgresConn struct {
+	*stdlib.Conn
+}
+
+func (c postgresConn) Prepare(query string) (driver.Stmt, error) {
+	return c.Conn.Prepare(rebind(query))
+}
+
+func (c postgresConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	return c.Conn.PrepareContext(ctx, rebind(query))
+}
+
+func (c postgresConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return c.Conn.ExecContext(ctx, rebind(query), args)
+}
+
+func (c postgresConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return c.Conn.QueryContext(ctx, rebind(query), args)
+}
+
+// Rewrites ? placeholders to $1, $2..., ignoring question marks in strings and quoted identifiers
+func rebind(query string) string {
+	if !strings.Contains(query, "?") {
+		return query
+	}
+
+	var (
+		b     strings.Builder
+		n     int
+		quote rune
+	)
+	for _, r := range query {
+		switch {
+		case quote != 0:
+			// escaped quotes like 'it''s' end and start the string again, which works out the same
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == '?':
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
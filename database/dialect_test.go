@@ -0,0 +1,59 @@
+package database
+
+import "testing"
+
+func TestRebind(t *testing.T) {
+	tests := []struct {
+		query, expected string
+	}{
+		{"SELECT 1", "SELECT 1"},
+		{"SELECT id FROM \"user\" WHERE id = ? AND name = ?", "SELECT id FROM \"user\" WHERE id = $1 AND name = $2"},
+		{"INSERT INTO t (a, b) VALUES ('what?', ?)", "INSERT INTO t (a, b) VALUES ('what?', $1)"},
+		{"SELECT 'it''s ?' FROM \"odd?\" WHERE a IN (?,?)", "SELECT 'it''s ?' FROM \"odd?\" WHERE a IN ($1,$2)"},
+	}
+
+	for _, test := range tests {
+		if actual := rebind(test.query); actual != test.expected {
+			t.Errorf("expected %q, got %q", test.expected, actual)
+		}
+	}
+}
+
+func TestTranslatePostgres(t *testing.T) {
+	tests := []struct {
+		stmt, expected string
+	}{
+		{
+			"CREATE TABLE t (id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT, n INTEGER NOT NULL)",
+			"CREATE TABLE t (id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY, n BIGINT NOT NULL)",
+		},
+		{
+			"CREATE TABLE t (id INTEGER PRIMARY KEY, name TEXT NOT NULL)",
+			"CREATE TABLE t (id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY, name TEXT NOT NULL)",
+		},
+		{"INSERT INTO t (name) VALUES ('INTEGERS')", "INSERT INTO t (name) VALUES ('INTEGERS')"},
+	}
+
+	for _, test := range tests {
+		if actual := Postgres.Translate(test.stmt); actual != test.expected {
+			t.Errorf("expected %q, got %q", test.expected, actual)
+		}
+		if actual := SQLite.Translate(test.stmt); actual != test.stmt {
+			t.Errorf("expected sqlite to leave %q unchanged, got %q", test.stmt, actual)
+		}
+	}
+}
+
+func TestDialectFor(t *testing.T) {
+	for _, driver := range []string{"sqlite3", "postgres"} {
+		dialect, err := DialectFor(driver)
+		if err != nil || dialect.Driver != driver {
+			t.Errorf("expected the %s dialect, got %q: %v", driver, dialect.Driver, err)
+		}
+	}
+
+	_, err := DialectFor("mysql")
+	if err == nil {
+		t.Error("expected an error for an unsupported driver")
+	}
+}
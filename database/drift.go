@@ -0,0 +1,271 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// The schema created by version 1 before the other migrations existed.
+// Replaying the migrations on top of it must result in the same database as CurrentSchema.
+func baselineSchema() []string {
+	return []string{
+		`CREATE TABLE user (
+			id TEXT NOT NULL PRIMARY KEY,
+			name TEXT NOT NULL,
+			permission_id INTEGER NOT NULL,
+			bot_is_joined BOOL NOT NULL DEFAULT false,
+			FOREIGN KEY (permission_id) REFERENCES permission(id)
+		)`,
+		`CREATE TABLE permission (
+			id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL,
+			is_ignored BOOL NOT NULL DEFAULT false,
+			is_bot_admin BOOL NOT NULL DEFAULT false
+		)`,
+		`CREATE TABLE command (
+			id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL
+		)`,
+		`CREATE INDEX idx_name ON command(name)`,
+		`CREATE TABLE user_command (
+			id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+			user_id TEXT NOT NULL,
+			command_id INTEGER NOT NULL,
+			is_enabled BOOL NOT NULL DEFAULT true,
+			FOREIGN KEY (user_id) REFERENCES user(id) ON DELETE CASCADE,
+			FOREIGN KEY (command_id) REFERENCES command(id) ON DELETE CASCADE
+		)`,
+		`CREATE INDEX idx_is_enabled ON user_command(is_enabled)`,
+
+		`INSERT INTO permission (name) VALUES ('user')`,
+		`INSERT INTO permission (name, is_ignored) VALUES ('banned', true)`,
+		`INSERT INTO permission (name, is_bot_admin) VALUES ('admin', true)`,
+	}
+}
+
+// commands are inserted by the bot when it first connects instead of by migrations,
+// so their data is expected to differ between fresh and migrated databases
+var driftIgnoredData = []string{"command", "user_command", "user_command_data"}
+
+// Drift is a difference between a fresh database and one created by replaying the migrations
+type Drift struct {
+	// Object is the table, index or table data that differs, like "index idx_name" or "data permission"
+	Object   string
+	Fresh    []string // only in the fresh database
+	Migrated []string // only in the migrated database
+}
+
+func (d Drift) String() string {
+	var b strings.Builder
+	b.WriteString(d.Object)
+	for _, line := range d.Fresh {
+		fmt.Fprintf(&b, "\n  fresh:    %s", line)
+	}
+	for _, line := range d.Migrated {
+		fmt.Fprintf(&b, "\n  migrated: %s", line)
+	}
+	return b.String()
+}
+
+// CheckDrift creates a database from the first migration, which is the current schema, and another from the
+// baseline schema and every other migration, and returns the differences in their schemas and seed data
+func CheckDrift(migrations *DBMigrations) ([]Drift, error) {
+	dir, err := os.MkdirTemp("", "monkebot-drift")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	var sorted DBMigrations
+	sorted.Migrations = slices.Clone(migrations.Migrations)
+	sort.Sort(&sorted)
+	if len(sorted.Migrations) == 0 || sorted.Migrations[0].Version != 1 {
+		return nil, fmt.Errorf("migration 1 not found")
+	}
+
+	freshStmts := sorted.Migrations[0].Stmts
+	migratedStmts := baselineSchema()
+	for _, migration := range sorted.Migrations[1:] {
+		migratedStmts = append(migratedStmts, migration.Stmts...)
+	}
+
+	fresh, err := describeDatabase(filepath.Join(dir, "fresh.db"), freshStmts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create fresh database: %w", err)
+	}
+	migrated, err := describeDatabase(filepath.Join(dir, "migrated.db"), migratedStmts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create migrated database: %w", err)
+	}
+
+	var objects []string
+	for object := range fresh {
+		objects = append(objects, object)
+	}
+	for object := range migrated {
+		if _, ok := fresh[object]; !ok {
+			objects = append(objects, object)
+		}
+	}
+	slices.Sort(objects)
+
+	var drifts []Drift
+	for _, object := range objects {
+		drift := Drift{Object: object}
+		for _, line := range fresh[object] {
+			if !slices.Contains(migrated[object], line) {
+				drift.Fresh = append(drift.Fresh, line)
+			}
+		}
+		for _, line := range migrated[object] {
+			if !slices.Contains(fresh[object], line) {
+				drift.Migrated = append(drift.Migrated, line)
+			}
+		}
+		// objects that exist in only one database have no lines in the other
+		if _, ok := fresh[object]; !ok {
+			drift.Fresh = append(drift.Fresh, "(missing)")
+		}
+		if _, ok := migrated[object]; !ok {
+			drift.Migrated = append(drift.Migrated, "(missing)")
+		}
+		if len(drift.Fresh) > 0 || len(drift.Migrated) > 0 {
+			drifts = append(drifts, drift)
+		}
+	}
+
+	return drifts, nil
+}
+
+// Creates a database at path with stmts, and describes every table, index and table data as lines of text
+func describeDatabase(path string, stmts []string) (map[string][]string, error) {
+	db, err := sql.Open("sqlite3", "file:"+path)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	for _, stmt := range stmts {
+		_, err = db.Exec(stmt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to execute %q: %w", stmt, err)
+		}
+	}
+
+	rows, err := db.Query("SELECT type, name, tbl_name FROM sqlite_master WHERE name NOT LIKE 'sqlite_%' ORDER BY name")
+	if err != nil {
+		return nil, fmt.Errorf("failed to select schema: %w", err)
+	}
+	var objects [][3]string
+	for rows.Next() {
+		var object [3]string
+		err = rows.Scan(&object[0], &object[1], &object[2])
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		objects = append(objects, object)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	description := make(map[string][]string)
+	for _, object := range objects {
+		kind, name, table := object[0], object[1], object[2]
+		var lines []string
+		switch kind {
+		case "table":
+			lines, err = queryLines(db, fmt.Sprintf("SELECT 'column ' || name || ' ' || type || ' notnull=' || \"notnull\" || ' default=' || IFNULL(dflt_value, 'NULL') || ' pk=' || pk FROM pragma_table_info('%s') ORDER BY cid", name))
+			if err != nil {
+				return nil, err
+			}
+			var foreignKeys []string
+			foreignKeys, err = queryLines(db, fmt.Sprintf("SELECT 'foreign key ' || \"from\" || ' references ' || \"table\" || '(' || IFNULL(\"to\", '') || ') on delete ' || on_delete FROM pragma_foreign_key_list('%s') ORDER BY \"from\"", name))
+			if err != nil {
+				return nil, err
+			}
+			lines = append(lines, foreignKeys...)
+
+			if !slices.Contains(driftIgnoredData, name) {
+				var data []string
+				data, err = tableData(db, name)
+				if err != nil {
+					return nil, err
+				}
+				description["data "+name] = data
+			}
+		case "index":
+			lines, err = queryLines(db, fmt.Sprintf("SELECT 'column ' || name FROM pragma_index_info('%s') ORDER BY seqno", name))
+			if err != nil {
+				return nil, err
+			}
+			lines = append([]string{"on " + table}, lines...)
+		default:
+			lines = []string{kind + " on " + table}
+		}
+		description[kind+" "+name] = lines
+	}
+
+	return description, nil
+}
+
+func queryLines(db *sql.DB, query string) ([]string, error) {
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe schema: %w", err)
+	}
+	defer rows.Close()
+
+	var lines []string
+	for rows.Next() {
+		var line string
+		err = rows.Scan(&line)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, line)
+	}
+	return lines, rows.Err()
+}
+
+// Returns the rows of a table as sorted lines
+func tableData(db *sql.DB, table string) ([]string, error) {
+	rows, err := db.Query(fmt.Sprintf("SELECT * FROM \"%s\"", table))
+	if err != nil {
+		return nil, fmt.Errorf("failed to select data from %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	var lines []string
+	for rows.Next() {
+		values := make([]any, len(columns))
+		pointers := make([]any, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		err = rows.Scan(pointers...)
+		if err != nil {
+			return nil, err
+		}
+
+		fields := make([]string, len(columns))
+		for i, column := range columns {
+			fields[i] = fmt.Sprintf("%s=%v", column, values[i])
+		}
+		lines = append(lines, strings.Join(fields, " "))
+	}
+	slices.Sort(lines)
+	return lines, rows.Err()
+}
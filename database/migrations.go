@@ -1,15 +1,24 @@
 package database
 
 import (
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
+	"errors"
 	"fmt"
-	"monkebot/config"
+	"io"
 	"sort"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
 )
 
 type DBMigration struct {
 	Version int
 	Stmts   []string
+	// Down reverts Stmts, migrations without it can't be rolled back
+	Down []string
 }
 
 // makes migrations sortable by version(implements sort.Interface)
@@ -124,44 +133,620 @@ var Migrations = DBMigrations{
 			WHERE c.name IN ('optin', 'optout')
 			`,
 		}},
+		{Version: 10, Stmts: []string{
+			`CREATE TABLE oauth_token (
+				id INTEGER NOT NULL PRIMARY KEY,
+				access_token TEXT NOT NULL,
+				refresh_token TEXT NOT NULL,
+				expires_at INTEGER NOT NULL
+			)`,
+		}, Down: []string{
+			"DROP TABLE oauth_token",
+		}},
+		{Version: 11, Stmts: []string{
+			`CREATE TABLE user_name_history (
+				id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+				user_id TEXT NOT NULL,
+				old_name TEXT NOT NULL,
+				new_name TEXT NOT NULL,
+				changed_at INTEGER NOT NULL,
+				FOREIGN KEY (user_id) REFERENCES user(id) ON DELETE CASCADE
+			)`,
+			`CREATE INDEX idx_user_name_history ON user_name_history(user_id)`,
+		}, Down: []string{
+			"DROP INDEX idx_user_name_history",
+			"DROP TABLE user_name_history",
+		}},
+		// the index kept its name when user_command_cooldown was renamed in version 8,
+		// but fresh databases create it as idx_user_command_data.
+		// Databases created fresh before this migration already have the right index, hence IF EXISTS.
+		{Version: 12, Stmts: []string{
+			"DROP INDEX IF EXISTS idx_user_command_cooldown",
+			"CREATE INDEX IF NOT EXISTS idx_user_command_data ON user_command_data(user_id, command_id, last_used)",
+		}, Down: []string{
+			"DROP INDEX idx_user_command_data",
+			"CREATE INDEX idx_user_command_cooldown ON user_command_data(user_id, command_id, last_used)",
+		}},
+		// user_command_data.user_id was created as an INTEGER in version 7, which postgres can't use as a foreign key to "user"(id).
+		// SQLite can't change a column's type, so the table is rebuilt.
+		{Version: 13, Stmts: []string{
+			`CREATE TABLE user_command_data_new (
+				id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+				user_id TEXT NOT NULL,
+				command_id INTEGER NOT NULL,
+				last_used INTEGER NOT NULL DEFAULT 1726849749,
+				opted_out BOOL NOT NULL DEFAULT false,
+				FOREIGN KEY (user_id) REFERENCES "user"(id) ON DELETE CASCADE,
+				FOREIGN KEY (command_id) REFERENCES command(id) ON DELETE CASCADE
+			)`,
+			`INSERT INTO user_command_data_new (id, user_id, command_id, last_used, opted_out)
+				SELECT id, CAST(user_id AS TEXT), command_id, last_used, opted_out FROM user_command_data`,
+			"DROP TABLE user_command_data",
+			"ALTER TABLE user_command_data_new RENAME TO user_command_data",
+			"CREATE INDEX idx_user_command_data ON user_command_data(user_id, command_id, last_used)",
+		}},
+		{Version: 14, Stmts: []string{
+			"INSERT INTO command (name) VALUES ('forgetme'), ('forgetuser')",
+			`INSERT INTO user_command (user_id, command_id, is_enabled)
+				SELECT u.id, c.id, true
+				FROM "user" u
+				CROSS JOIN command c
+				WHERE c.name IN ('forgetme', 'forgetuser')`,
+			`INSERT INTO user_command_data (user_id, command_id)
+				SELECT u.id, c.id
+				FROM "user" u
+				CROSS JOIN command c
+				WHERE c.name IN ('forgetme', 'forgetuser')`,
+		}, Down: []string{
+			"DELETE FROM command WHERE name IN ('forgetme', 'forgetuser')",
+		}},
+		{Version: 15, Stmts: []string{
+			"INSERT INTO command (name) VALUES ('explore stats')",
+			`INSERT INTO user_command (user_id, command_id, is_enabled)
+				SELECT u.id, c.id, true
+				FROM "user" u
+				CROSS JOIN command c
+				WHERE c.name = 'explore stats'`,
+			`INSERT INTO user_command_data (user_id, command_id)
+				SELECT u.id, c.id
+				FROM "user" u
+				CROSS JOIN command c
+				WHERE c.name = 'explore stats'`,
+		}, Down: []string{
+			"DELETE FROM command WHERE name = 'explore stats'",
+		}},
+		{Version: 16, Stmts: []string{
+			`CREATE TABLE custom_command (
+				id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+				channel_id TEXT NOT NULL,
+				name TEXT NOT NULL,
+				response TEXT NOT NULL,
+				is_enabled BOOL NOT NULL DEFAULT true,
+				last_used INTEGER NOT NULL DEFAULT 0,
+				UNIQUE (channel_id, name),
+				FOREIGN KEY (channel_id) REFERENCES "user"(id) ON DELETE CASCADE
+			)`,
+			`CREATE TABLE custom_command_data (
+				id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+				custom_command_id INTEGER NOT NULL,
+				user_id TEXT NOT NULL,
+				last_used INTEGER NOT NULL DEFAULT 0,
+				UNIQUE (custom_command_id, user_id),
+				FOREIGN KEY (custom_command_id) REFERENCES custom_command(id) ON DELETE CASCADE,
+				FOREIGN KEY (user_id) REFERENCES "user"(id) ON DELETE CASCADE
+			)`,
+			"INSERT INTO command (name) VALUES ('addcmd'), ('editcmd'), ('delcmd'), ('listcmds')",
+			`INSERT INTO user_command (user_id, command_id, is_enabled)
+				SELECT u.id, c.id, true
+				FROM "user" u
+				CROSS JOIN command c
+				WHERE c.name IN ('addcmd', 'editcmd', 'delcmd', 'listcmds')`,
+			`INSERT INTO user_command_data (user_id, command_id)
+				SELECT u.id, c.id
+				FROM "user" u
+				CROSS JOIN command c
+				WHERE c.name IN ('addcmd', 'editcmd', 'delcmd', 'listcmds')`,
+		}, Down: []string{
+			"DELETE FROM command WHERE name IN ('addcmd', 'editcmd', 'delcmd', 'listcmds')",
+			"DROP TABLE custom_command_data",
+			"DROP TABLE custom_command",
+		}},
+		{Version: 17, Stmts: []string{
+			`CREATE TABLE command_counter (
+				id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+				channel_id TEXT NOT NULL,
+				name TEXT NOT NULL,
+				count INTEGER NOT NULL DEFAULT 0,
+				UNIQUE (channel_id, name),
+				FOREIGN KEY (channel_id) REFERENCES "user"(id) ON DELETE CASCADE
+			)`,
+		}, Down: []string{
+			"DROP TABLE command_counter",
+		}},
+		{Version: 18, Stmts: []string{
+			`ALTER TABLE "user" ADD prefix TEXT`,
+			"INSERT INTO command (name) VALUES ('prefix')",
+			`INSERT INTO user_command (user_id, command_id, is_enabled)
+				SELECT u.id, c.id, true
+				FROM "user" u
+				CROSS JOIN command c
+				WHERE c.name = 'prefix'`,
+			`INSERT INTO user_command_data (user_id, command_id)
+				SELECT u.id, c.id
+				FROM "user" u
+				CROSS JOIN command c
+				WHERE c.name = 'prefix'`,
+		}, Down: []string{
+			"DELETE FROM command WHERE name = 'prefix'",
+			`ALTER TABLE "user" DROP COLUMN prefix`,
+		}},
+		{Version: 19, Stmts: []string{
+			"ALTER TABLE user_command ADD channel_cooldown INTEGER",
+			"ALTER TABLE user_command ADD user_cooldown INTEGER",
+			"INSERT INTO command (name) VALUES ('cooldown')",
+			`INSERT INTO user_command (user_id, command_id, is_enabled)
+				SELECT u.id, c.id, true
+				FROM "user" u
+				CROSS JOIN command c
+				WHERE c.name = 'cooldown'`,
+			`INSERT INTO user_command_data (user_id, command_id)
+				SELECT u.id, c.id
+				FROM "user" u
+				CROSS JOIN command c
+				WHERE c.name = 'cooldown'`,
+		}, Down: []string{
+			"DELETE FROM command WHERE name = 'cooldown'",
+			"ALTER TABLE user_command DROP COLUMN user_cooldown",
+			"ALTER TABLE user_command DROP COLUMN channel_cooldown",
+		}},
+		{Version: 20, Stmts: []string{
+			`CREATE TABLE channel_role (
+				id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+				channel_id TEXT NOT NULL,
+				user_id TEXT NOT NULL,
+				role TEXT NOT NULL,
+				UNIQUE (channel_id, user_id, role),
+				FOREIGN KEY (channel_id) REFERENCES "user"(id) ON DELETE CASCADE,
+				FOREIGN KEY (user_id) REFERENCES "user"(id) ON DELETE CASCADE
+			)`,
+			"INSERT INTO command (name) VALUES ('role'), ('role add'), ('role remove'), ('role list')",
+			`INSERT INTO user_command (user_id, command_id, is_enabled)
+				SELECT u.id, c.id, true
+				FROM "user" u
+				CROSS JOIN command c
+				WHERE c.name IN ('role', 'role add', 'role remove', 'role list')`,
+			`INSERT INTO user_command_data (user_id, command_id)
+				SELECT u.id, c.id
+				FROM "user" u
+				CROSS JOIN command c
+				WHERE c.name IN ('role', 'role add', 'role remove', 'role list')`,
+		}, Down: []string{
+			"DELETE FROM command WHERE name IN ('role', 'role add', 'role remove', 'role list')",
+			"DROP TABLE channel_role",
+		}},
+		{Version: 21, Stmts: []string{
+			"INSERT INTO command (name) VALUES ('prefix set'), ('prefix reset')",
+			`INSERT INTO user_command (user_id, command_id, is_enabled)
+				SELECT u.id, c.id, true
+				FROM "user" u
+				CROSS JOIN command c
+				WHERE c.name IN ('prefix set', 'prefix reset')`,
+			`INSERT INTO user_command_data (user_id, command_id)
+				SELECT u.id, c.id
+				FROM "user" u
+				CROSS JOIN command c
+				WHERE c.name IN ('prefix set', 'prefix reset')`,
+		}, Down: []string{
+			"DELETE FROM command WHERE name IN ('prefix set', 'prefix reset')",
+		}},
+		{Version: 22, Stmts: []string{
+			"ALTER TABLE custom_command ADD channel_cooldown INTEGER",
+			"ALTER TABLE custom_command ADD user_cooldown INTEGER",
+		}, Down: []string{
+			"ALTER TABLE custom_command DROP COLUMN user_cooldown",
+			"ALTER TABLE custom_command DROP COLUMN channel_cooldown",
+		}},
+		{Version: 23, Stmts: []string{
+			"ALTER TABLE oauth_token ADD config_refresh_token TEXT NOT NULL DEFAULT ''",
+		}, Down: []string{
+			"ALTER TABLE oauth_token DROP COLUMN config_refresh_token",
+		}},
+		{Version: 24, Stmts: []string{
+			"INSERT INTO command (name) VALUES ('join channel'), ('part channel')",
+			`INSERT INTO user_command (user_id, command_id, is_enabled)
+				SELECT u.id, c.id, true
+				FROM "user" u
+				CROSS JOIN command c
+				WHERE c.name IN ('join channel', 'part channel')`,
+			`INSERT INTO user_command_data (user_id, command_id)
+				SELECT u.id, c.id
+				FROM "user" u
+				CROSS JOIN command c
+				WHERE c.name IN ('join channel', 'part channel')`,
+		}, Down: []string{
+			"DELETE FROM command WHERE name IN ('join channel', 'part channel')",
+		}},
 	},
 }
 
-// Run migrations in the database.
-// If the migration succeeds, the version in DBConfig is updated to the current version
-// and should be saved in the config file.
-func RunMigrations(tx *sql.Tx, config *config.Config, migrations *DBMigrations) error {
+var (
+	ErrChecksumMismatch = errors.New("migration checksum mismatch")
+	ErrNoDownMigration  = errors.New("migration can't be rolled back")
+)
+
+// Checksum identifies a migration's statements, to detect migrations changed after being applied.
+// Down isn't included, so it can be added to migrations that were already applied.
+func (m DBMigration) Checksum() string {
+	h := sha256.New()
+	for _, stmt := range m.Stmts {
+		h.Write([]byte(stmt))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+type AppliedMigration struct {
+	Version   int
+	AppliedAt time.Time
+	Checksum  string
+}
+
+func createMigrationsTable(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER NOT NULL PRIMARY KEY,
+			applied_at BIGINT NOT NULL,
+			checksum TEXT NOT NULL
+		)`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+	return nil
+}
+
+// Returns the migrations recorded in schema_migrations, sorted by version
+func SelectAppliedMigrations(tx *sql.Tx) ([]AppliedMigration, error) {
+	err := createMigrationsTable(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query("SELECT version, applied_at, checksum FROM schema_migrations ORDER BY version")
+	if err != nil {
+		return nil, fmt.Errorf("failed to select applied migrations: %w", err)
+	}
+	defer rows.Close()
+
+	var applied []AppliedMigration
+	for rows.Next() {
+		var (
+			migration AppliedMigration
+			appliedAt int64
+		)
+		err = rows.Scan(&migration.Version, &appliedAt, &migration.Checksum)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan applied migration: %w", err)
+		}
+		migration.AppliedAt = time.Unix(appliedAt, 0)
+		applied = append(applied, migration)
+	}
+
+	return applied, rows.Err()
+}
+
+func insertAppliedMigration(tx *sql.Tx, migration DBMigration) error {
+	_, err := tx.Exec("INSERT INTO schema_migrations (version, applied_at, checksum) VALUES (?, ?, ?)", migration.Version, time.Now().Unix(), migration.Checksum())
+	if err != nil {
+		return fmt.Errorf("failed to record migration %d: %w", migration.Version, err)
+	}
+	return nil
+}
+
+func tableExists(tx *sql.Tx, dialect Dialect, name string) (bool, error) {
+	var exists bool
+	err := tx.QueryRow(dialect.tableExistsQuery, name).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check if table %s exists: %w", name, err)
+	}
+	return exists, nil
+}
+
+// Returns the migrations that weren't applied yet, in the order they should run.
+// The first time it runs on a database created before schema_migrations, the migrations up to legacyVersion are recorded as applied.
+func pendingMigrations(tx *sql.Tx, dialect Dialect, migrations *DBMigrations, legacyVersion int) ([]DBMigration, error) {
 	// sort migrations by version
 	sort.Sort(migrations)
 
-	var err error
+	applied, err := SelectAppliedMigrations(tx)
+	if err != nil {
+		return nil, err
+	}
 
-	// migrations to be applied sequentially until the currentVersion
-	migrationsApplied := 0
-	currentVersion := config.DBConfig.Version
-	for i := currentVersion; i < len(migrations.Migrations); i++ {
-		migration := migrations.Migrations[i]
+	if len(applied) == 0 {
+		// permission is created by the first migration, so if it exists this isn't a new database
+		var isLegacy bool
+		isLegacy, err = tableExists(tx, dialect, "permission")
+		if err != nil {
+			return nil, err
+		}
 
-		for _, stmt := range migration.Stmts {
-			_, err = tx.Exec(stmt)
+		if isLegacy && legacyVersion == 0 {
+			return nil, fmt.Errorf("database has tables but no recorded migrations, set DBConfig.Version in the config to the database's version to import it")
+		}
+
+		if isLegacy {
+			for _, migration := range migrations.Migrations {
+				if migration.Version > legacyVersion {
+					break
+				}
+				err = insertAppliedMigration(tx, migration)
+				if err != nil {
+					return nil, err
+				}
+			}
+			log.Info().Int("version", legacyVersion).Msg("imported schema version from the config, DBConfig.Version is no longer used and can be removed")
+
+			applied, err = SelectAppliedMigrations(tx)
 			if err != nil {
-				return fmt.Errorf("failed to execute migration: %w", err)
+				return nil, err
 			}
 		}
-		migrationsApplied++
+	}
+
+	checksums := make(map[int]string, len(applied))
+	for _, migration := range applied {
+		checksums[migration.Version] = migration.Checksum
+	}
 
-		// version 1 creates the database from scratch so there's no need to run the other migrations,
-		// and we can just update the version to the latest one.
+	var pending []DBMigration
+	for _, migration := range migrations.Migrations {
+		checksum, isApplied := checksums[migration.Version]
+		// version 1 is the current schema, which changes with every new migration, so its checksum isn't checked
+		if isApplied && migration.Version != 1 && checksum != migration.Checksum() {
+			return nil, fmt.Errorf("%w: migration %d was changed after being applied", ErrChecksumMismatch, migration.Version)
+		}
+		if isApplied {
+			continue
+		}
+
+		pending = append(pending, migration)
+		// version 1 creates the database from scratch so there's no need to run the other migrations
 		if migration.Version == 1 {
-			currentVersion = migrations.Migrations[len(migrations.Migrations)-1].Version
 			break
 		}
 	}
 
-	if migrationsApplied == 0 {
-		return nil
+	return pending, nil
+}
+
+// Runs a migration's statements and records it in schema_migrations.
+// Version 1 creates the current schema, so the other migrations are recorded as applied as well.
+func applyMigration(tx *sql.Tx, dialect Dialect, migrations *DBMigrations, migration DBMigration) error {
+	for _, stmt := range migration.Stmts {
+		_, err := tx.Exec(dialect.Translate(stmt))
+		if err != nil {
+			return fmt.Errorf("failed to execute migration %d: %w", migration.Version, err)
+		}
+	}
+
+	err := insertAppliedMigration(tx, migration)
+	if err != nil {
+		return err
+	}
+
+	if migration.Version == 1 {
+		for _, newer := range migrations.Migrations[1:] {
+			err = insertAppliedMigration(tx, newer)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	log.Info().Int("version", migration.Version).Msg("applied migration")
+	return nil
+}
+
+// Run the migrations that weren't applied yet in tx, recording them in schema_migrations.
+// legacyVersion is the version saved in the config by older versions of the bot. It's only used once,
+// to record which migrations were already applied to a database created before schema_migrations existed.
+func RunMigrations(tx *sql.Tx, dialect Dialect, migrations *DBMigrations, legacyVersion int) error {
+	pending, err := pendingMigrations(tx, dialect, migrations, legacyVersion)
+	if err != nil {
+		return err
+	}
+
+	for _, migration := range pending {
+		err = applyMigration(tx, dialect, migrations, migration)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Like RunMigrations, but each migration runs in its own transaction, so a failed migration
+// leaves the database at the last one that succeeded
+func Migrate(db *sql.DB, dialect Dialect, migrations *DBMigrations, legacyVersion int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	pending, err := pendingMigrations(tx, dialect, migrations, legacyVersion)
+	if err != nil {
+		return err
+	}
+
+	// commits the legacy version import
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	for _, migration := range pending {
+		err = inTx(db, func(tx *sql.Tx) error {
+			return applyMigration(tx, dialect, migrations, migration)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Reverts the last steps applied migrations using their Down statements, each in its own transaction
+func MigrateDown(db *sql.DB, dialect Dialect, migrations *DBMigrations, steps int) error {
+	byVersion := make(map[int]DBMigration, len(migrations.Migrations))
+	for _, migration := range migrations.Migrations {
+		byVersion[migration.Version] = migration
+	}
+
+	for range steps {
+		err := inTx(db, func(tx *sql.Tx) error {
+			applied, err := SelectAppliedMigrations(tx)
+			if err != nil {
+				return err
+			}
+			if len(applied) == 0 {
+				return fmt.Errorf("%w: no migrations were applied", ErrNoDownMigration)
+			}
+
+			last := applied[len(applied)-1]
+			migration, ok := byVersion[last.Version]
+			if !ok || len(migration.Down) == 0 {
+				return fmt.Errorf("%w: migration %d has no down statements", ErrNoDownMigration, last.Version)
+			}
+
+			for _, stmt := range migration.Down {
+				_, err = tx.Exec(dialect.Translate(stmt))
+				if err != nil {
+					return fmt.Errorf("failed to execute down migration %d: %w", migration.Version, err)
+				}
+			}
+
+			_, err = tx.Exec("DELETE FROM schema_migrations WHERE version = ?", migration.Version)
+			if err != nil {
+				return fmt.Errorf("failed to delete migration %d from schema_migrations: %w", migration.Version, err)
+			}
+
+			log.Info().Int("version", migration.Version).Msg("reverted migration")
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Writes the statements of the migrations that weren't applied yet to w as they would run on the dialect, without running them
+func DryRun(db *sql.DB, dialect Dialect, migrations *DBMigrations, legacyVersion int, w io.Writer) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	// nothing is committed, even the legacy version import
+	defer tx.Rollback()
+
+	pending, err := pendingMigrations(tx, dialect, migrations, legacyVersion)
+	if err != nil {
+		return err
+	}
+
+	if len(pending) == 0 {
+		_, err = fmt.Fprintln(w, "-- no pending migrations")
+		return err
+	}
+
+	for _, migration := range pending {
+		_, err = fmt.Fprintf(w, "-- migration %d\n", migration.Version)
+		if err != nil {
+			return err
+		}
+		for _, stmt := range migration.Stmts {
+			_, err = fmt.Fprintf(w, "%s;\n", strings.TrimSpace(dialect.Translate(stmt)))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+type MigrationStatus struct {
+	Version   int
+	Applied   bool
+	AppliedAt time.Time
+	// Changed is true if the migration's statements changed after it was applied
+	Changed bool
+	// Unknown is true for applied migrations that aren't in this version of the bot, like after a downgrade
+	Unknown bool
+	HasDown bool
+}
+
+// Returns the status of every known or applied migration, sorted by version
+func SelectMigrationStatus(db *sql.DB, migrations *DBMigrations) ([]MigrationStatus, error) {
+	sort.Sort(migrations)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	applied, err := SelectAppliedMigrations(tx)
+	if err != nil {
+		return nil, err
+	}
+	appliedByVersion := make(map[int]AppliedMigration, len(applied))
+	for _, migration := range applied {
+		appliedByVersion[migration.Version] = migration
+	}
+
+	var statuses []MigrationStatus
+	known := make(map[int]bool, len(migrations.Migrations))
+	for _, migration := range migrations.Migrations {
+		known[migration.Version] = true
+		status := MigrationStatus{Version: migration.Version, HasDown: len(migration.Down) > 0}
+		if a, ok := appliedByVersion[migration.Version]; ok {
+			status.Applied = true
+			status.AppliedAt = a.AppliedAt
+			status.Changed = migration.Version != 1 && a.Checksum != migration.Checksum()
+		}
+		statuses = append(statuses, status)
+	}
+
+	for _, a := range applied {
+		if !known[a.Version] {
+			statuses = append(statuses, MigrationStatus{Version: a.Version, Applied: true, AppliedAt: a.AppliedAt, Unknown: true})
+		}
 	}
 
-	config.DBConfig.Version = migrations.Migrations[len(migrations.Migrations)-1].Version
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses, tx.Commit()
+}
+
+func inTx(db *sql.DB, f func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	err = f(tx)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
 	return nil
 }
@@ -1,7 +1,9 @@
 package database
 
 import (
-	"monkebot/config"
+	"bytes"
+	"errors"
+	"strings"
 	"testing"
 )
 
@@ -12,21 +14,12 @@ func TestRunMigrationsCurrentSchema(t *testing.T) {
 		},
 	}
 
-	var (
-		cfg *config.Config
-		err error
-	)
-
-	cfg, err = generateTestConfig()
-	if err != nil {
-		t.Errorf("failed to generate test config: %v", err)
-	}
 	tx, err := testDB.Begin()
 	defer tx.Rollback()
 	if err != nil {
 		t.Errorf("failed to begin transaction: %v", err)
 	}
-	err = RunMigrations(tx, cfg, &migrations)
+	err = RunMigrations(tx, testDialect, &migrations, 0)
 	if err != nil {
 		t.Errorf("failed to run migrations with current schema: %v", err)
 	}
@@ -52,28 +45,32 @@ func TestRunMigrationsCurrentSchemaAndNewMigrations(t *testing.T) {
 		},
 	}
 
-	var (
-		cfg *config.Config
-		err error
-	)
-
-	cfg, err = generateTestConfig()
-	if err != nil {
-		t.Errorf("failed to generate test config: %v", err)
-	}
-
 	tx, err := testDB.Begin()
 	defer tx.Rollback()
 	if err != nil {
 		t.Errorf("failed to begin transaction: %v", err)
 	}
-	err = RunMigrations(tx, cfg, &migrations)
+	err = RunMigrations(tx, testDialect, &migrations, 0)
 	if err != nil {
 		t.Errorf("failed to run migrations with current schema: %v", err)
 	}
 
-	if cfg.DBConfig.Version != 3 {
-		t.Errorf("expected version 3, got %d", cfg.DBConfig.Version)
+	// the current schema already includes the newer migrations, so they're only recorded
+	applied, err := SelectAppliedMigrations(tx)
+	if err != nil {
+		t.Fatalf("failed to select applied migrations: %v", err)
+	}
+	if len(applied) != 3 || applied[2].Version != 3 || applied[2].Checksum != migrations.Migrations[2].Checksum() {
+		t.Errorf("expected versions 1 to 3 to be recorded, got %+v", applied)
+	}
+
+	var exists bool
+	exists, err = tableExists(tx, testDialect, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exists {
+		t.Error("expected migration 2 to be skipped on a new database")
 	}
 }
 
@@ -84,43 +81,34 @@ func TestRunMigrationsNewMigrations(t *testing.T) {
 			{Version: 2, Stmts: []string{
 				"CREATE TABLE test (id INTEGER PRIMARY KEY, name TEXT NOT NULL)",
 			}},
-			{Version: 3, Stmts: []string{
-				"INSERT INTO test (name) VALUES ('test')",
-			}},
 		},
 	}
 
-	var (
-		cfg *config.Config
-		err error
-	)
-
 	tx, err := testDB.Begin()
 	defer tx.Rollback()
 	if err != nil {
 		t.Errorf("failed to begin transaction: %v", err)
 	}
 
-	cfg, err = generateTestConfig()
+	err = RunMigrations(tx, testDialect, &migrations, 0)
 	if err != nil {
-		t.Errorf("failed to generate test config: %v", err)
+		t.Fatalf("failed to run migrations: %v", err)
 	}
-	_, err = tx.Exec("CREATE TABLE test (id INTEGER PRIMARY KEY, name TEXT NOT NULL)")
+	_, err = tx.Exec(testDialect.Translate("CREATE TABLE test (id INTEGER PRIMARY KEY, name TEXT NOT NULL)"))
 	if err != nil {
 		t.Errorf("failed to create test table: %v", err)
 	}
 
-	cfg.DBConfig.Version = 2
+	// a new release adds migration 3
+	migrations.Migrations = append(migrations.Migrations, DBMigration{Version: 3, Stmts: []string{
+		"INSERT INTO test (name) VALUES ('test')",
+	}})
 
-	err = RunMigrations(tx, cfg, &migrations)
+	err = RunMigrations(tx, testDialect, &migrations, 0)
 	if err != nil {
 		t.Errorf("failed to run migrations: %v", err)
 	}
 
-	if cfg.DBConfig.Version != 3 {
-		t.Errorf("expected version 3, got %d", cfg.DBConfig.Version)
-	}
-
 	res := tx.QueryRow("SELECT id, name FROM test")
 	var (
 		id   int
@@ -133,4 +121,216 @@ func TestRunMigrationsNewMigrations(t *testing.T) {
 	if name != "test" {
 		t.Errorf("unexpected name value: %s", name)
 	}
+
+	// running again doesn't apply anything
+	err = RunMigrations(tx, testDialect, &migrations, 0)
+	if err != nil {
+		t.Errorf("failed to run migrations: %v", err)
+	}
+	var count int
+	err = tx.QueryRow("SELECT COUNT(*) FROM test").Scan(&count)
+	if err != nil || count != 1 {
+		t.Errorf("expected migration 3 to run once, got %d rows: %v", count, err)
+	}
+}
+
+func TestRunMigrationsImportsLegacyVersion(t *testing.T) {
+	migrations := DBMigrations{
+		Migrations: []DBMigration{
+			{Version: 1, Stmts: CurrentSchema()},
+			{Version: 2, Stmts: []string{
+				"CREATE TABLE test (id INTEGER PRIMARY KEY, name TEXT NOT NULL)",
+			}},
+			{Version: 3, Stmts: []string{
+				"INSERT INTO test (name) VALUES ('test')",
+			}},
+		},
+	}
+
+	tx, err := testDB.Begin()
+	defer tx.Rollback()
+	if err != nil {
+		t.Errorf("failed to begin transaction: %v", err)
+	}
+
+	// a database created before schema_migrations, at version 2 according to the config
+	for _, stmt := range append(CurrentSchema(), migrations.Migrations[1].Stmts...) {
+		_, err = tx.Exec(testDialect.Translate(stmt))
+		if err != nil {
+			t.Fatalf("failed to create legacy database: %v", err)
+		}
+	}
+
+	err = RunMigrations(tx, testDialect, &migrations, 0)
+	if err == nil {
+		t.Error("expected an error for a database with tables but no version")
+	}
+
+	err = RunMigrations(tx, testDialect, &migrations, 2)
+	if err != nil {
+		t.Fatalf("failed to run migrations: %v", err)
+	}
+
+	var name string
+	err = tx.QueryRow("SELECT name FROM test").Scan(&name)
+	if err != nil || name != "test" {
+		t.Errorf("expected migration 3 to run after importing version 2, got %q: %v", name, err)
+	}
+
+	applied, err := SelectAppliedMigrations(tx)
+	if err != nil {
+		t.Fatalf("failed to select applied migrations: %v", err)
+	}
+	if len(applied) != 3 {
+		t.Errorf("expected 3 applied migrations, got %+v", applied)
+	}
+}
+
+func TestRunMigrationsChecksumMismatch(t *testing.T) {
+	migrations := DBMigrations{
+		Migrations: []DBMigration{
+			{Version: 1, Stmts: CurrentSchema()},
+			{Version: 2, Stmts: []string{
+				"CREATE TABLE test (id INTEGER PRIMARY KEY, name TEXT NOT NULL)",
+			}},
+		},
+	}
+
+	tx, err := testDB.Begin()
+	defer tx.Rollback()
+	if err != nil {
+		t.Errorf("failed to begin transaction: %v", err)
+	}
+
+	err = RunMigrations(tx, testDialect, &migrations, 0)
+	if err != nil {
+		t.Fatalf("failed to run migrations: %v", err)
+	}
+
+	migrations.Migrations[1].Stmts = []string{"CREATE TABLE test (id INTEGER PRIMARY KEY)"}
+	err = RunMigrations(tx, testDialect, &migrations, 0)
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("expected ErrChecksumMismatch for a changed migration, got %v", err)
+	}
+
+	// the current schema changes with every migration
+	migrations.Migrations[1].Stmts = []string{"CREATE TABLE test (id INTEGER PRIMARY KEY, name TEXT NOT NULL)"}
+	migrations.Migrations[0].Stmts = append(CurrentSchema(), "CREATE TABLE test (id INTEGER PRIMARY KEY, name TEXT NOT NULL)")
+	err = RunMigrations(tx, testDialect, &migrations, 0)
+	if err != nil {
+		t.Errorf("expected changes to version 1 to be ignored, got %v", err)
+	}
+}
+
+func TestMigrateUpAndDown(t *testing.T) {
+	db, err := OpenDB(newTestDataSource(t))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	// like the real migrations, the current schema includes the changes of the other migrations
+	migrations := DBMigrations{
+		Migrations: []DBMigration{
+			{Version: 1, Stmts: append(CurrentSchema(), "CREATE TABLE test (id INTEGER PRIMARY KEY, name TEXT NOT NULL)")},
+			{Version: 2, Stmts: []string{
+				"CREATE TABLE test (id INTEGER PRIMARY KEY, name TEXT NOT NULL)",
+			}, Down: []string{
+				"DROP TABLE test",
+			}},
+		},
+	}
+
+	err = Migrate(db, testDialect, &migrations, 0)
+	if err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	err = MigrateDown(db, testDialect, &migrations, 1)
+	if err != nil {
+		t.Fatalf("failed to migrate down: %v", err)
+	}
+
+	var buf bytes.Buffer
+	err = DryRun(db, testDialect, &migrations, 0, &buf)
+	if err != nil {
+		t.Fatalf("failed to dry run: %v", err)
+	}
+	if buf.String() != "-- migration 2\n"+testDialect.Translate("CREATE TABLE test (id INTEGER PRIMARY KEY, name TEXT NOT NULL)")+";\n" {
+		t.Errorf("unexpected dry run output: %q", buf.String())
+	}
+
+	statuses, err := SelectMigrationStatus(db, &migrations)
+	if err != nil {
+		t.Fatalf("failed to select migration status: %v", err)
+	}
+	if len(statuses) != 2 || !statuses[0].Applied || statuses[1].Applied || !statuses[1].HasDown {
+		t.Errorf("expected migration 1 applied and 2 pending, got %+v", statuses)
+	}
+
+	err = Migrate(db, testDialect, &migrations, 0)
+	if err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	err = db.QueryRow("SELECT COUNT(*) FROM test").Scan(new(int))
+	if err != nil {
+		t.Errorf("expected migration 2 to create the test table again: %v", err)
+	}
+
+	// migration 1 can't be reverted
+	err = MigrateDown(db, testDialect, &migrations, 2)
+	if !errors.Is(err, ErrNoDownMigration) {
+		t.Errorf("expected ErrNoDownMigration, got %v", err)
+	}
+	statuses, err = SelectMigrationStatus(db, &migrations)
+	if err != nil {
+		t.Fatalf("failed to select migration status: %v", err)
+	}
+	if !statuses[0].Applied || statuses[1].Applied {
+		t.Errorf("expected only migration 2 to be reverted, got %+v", statuses)
+	}
+
+	buf.Reset()
+	err = DryRun(db, testDialect, &migrations, 0, &buf)
+	if err != nil || !strings.Contains(buf.String(), "migration 2") {
+		t.Errorf("expected migration 2 in the dry run, got %q: %v", buf.String(), err)
+	}
+}
+
+func TestCheckDrift(t *testing.T) {
+	drifts, err := CheckDrift(&Migrations)
+	if err != nil {
+		t.Fatalf("failed to check drift: %v", err)
+	}
+	for _, drift := range drifts {
+		t.Errorf("schema drift between CurrentSchema and the migrations, update one of them:\n%s", drift)
+	}
+}
+
+func TestCheckDriftReportsDifferences(t *testing.T) {
+	migrations := DBMigrations{
+		Migrations: []DBMigration{
+			{Version: 1, Stmts: append(CurrentSchema(), "INSERT INTO permission (name) VALUES ('vip')")},
+		},
+	}
+	// every migration except the first, with a column missing from CurrentSchema
+	migrations.Migrations = append(migrations.Migrations, Migrations.Migrations[1:]...)
+	migrations.Migrations = append(migrations.Migrations, DBMigration{Version: 100, Stmts: []string{
+		`ALTER TABLE "user" ADD nickname TEXT`,
+	}})
+
+	drifts, err := CheckDrift(&migrations)
+	if err != nil {
+		t.Fatalf("failed to check drift: %v", err)
+	}
+
+	if len(drifts) != 2 {
+		t.Fatalf("expected 2 differences, got %v", drifts)
+	}
+	if drifts[0].Object != "data permission" || len(drifts[0].Fresh) != 1 || !strings.Contains(drifts[0].Fresh[0], "name=vip") {
+		t.Errorf("expected the vip permission only in the fresh database, got %s", drifts[0])
+	}
+	if drifts[1].Object != "table user" || len(drifts[1].Migrated) != 1 || !strings.HasPrefix(drifts[1].Migrated[0], "column nickname") {
+		t.Errorf("expected the nickname column only in the migrated database, got %s", drifts[1])
+	}
 }
@@ -1,21 +1,23 @@
 package database
 
+// Tables are created after the ones they reference, as postgres requires
 func CurrentSchema() []string {
 	return []string{
 		// DDL
-		`CREATE TABLE user (
-			id TEXT NOT NULL PRIMARY KEY,
-			name TEXT NOT NULL,
-			permission_id INTEGER NOT NULL,
-			bot_is_joined BOOL NOT NULL DEFAULT false,
-			FOREIGN KEY (permission_id) REFERENCES permission(id)
-		)`,
 		`CREATE TABLE permission (
 			id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
 			name TEXT NOT NULL,
 			is_ignored BOOL NOT NULL DEFAULT false,
 			is_bot_admin BOOL NOT NULL DEFAULT false
 		)`,
+		`CREATE TABLE "user" (
+			id TEXT NOT NULL PRIMARY KEY,
+			name TEXT NOT NULL,
+			permission_id INTEGER NOT NULL,
+			bot_is_joined BOOL NOT NULL DEFAULT false,
+			prefix TEXT,
+			FOREIGN KEY (permission_id) REFERENCES permission(id)
+		)`,
 		`CREATE TABLE command (
 			id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
 			name TEXT NOT NULL
@@ -27,18 +29,20 @@ func CurrentSchema() []string {
 			command_id INTEGER NOT NULL,
 			is_enabled BOOL NOT NULL DEFAULT true,
 			last_used INTEGER NOT NULL DEFAULT 1726849749,
-			FOREIGN KEY (user_id) REFERENCES user(id) ON DELETE CASCADE,
+			channel_cooldown INTEGER,
+			user_cooldown INTEGER,
+			FOREIGN KEY (user_id) REFERENCES "user"(id) ON DELETE CASCADE,
 			FOREIGN KEY (command_id) REFERENCES command(id) ON DELETE CASCADE
 		)`,
 		`CREATE INDEX idx_is_enabled ON user_command(is_enabled)`,
 		`CREATE INDEX idx_user_command ON user_command(user_id, command_id)`,
 		`CREATE TABLE user_command_data (
 			id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
-			user_id INTEGER NOT NULL,
+			user_id TEXT NOT NULL,
 			command_id INTEGER NOT NULL,
 			last_used INTEGER NOT NULL DEFAULT 1726849749,
 			opted_out BOOL NOT NULL DEFAULT false,
-			FOREIGN KEY (user_id) REFERENCES user(id) ON DELETE CASCADE,
+			FOREIGN KEY (user_id) REFERENCES "user"(id) ON DELETE CASCADE,
 			FOREIGN KEY (command_id) REFERENCES command(id) ON DELETE CASCADE
 		)`,
 		`CREATE INDEX idx_user_command_data ON user_command_data(user_id, command_id, last_used)`,
@@ -53,9 +57,63 @@ func CurrentSchema() []string {
 			rpg_item_id INTEGER NOT NULL,
 			amount INTEGER NOT NULL,
 
-			FOREIGN KEY (user_id) REFERENCES user(id) ON DELETE CASCADE,
+			FOREIGN KEY (user_id) REFERENCES "user"(id) ON DELETE CASCADE,
 			FOREIGN KEY (rpg_item_id) REFERENCES rpg_item(id) ON DELETE CASCADE
 		)`,
+		`CREATE TABLE oauth_token (
+			id INTEGER NOT NULL PRIMARY KEY,
+			access_token TEXT NOT NULL,
+			refresh_token TEXT NOT NULL,
+			expires_at INTEGER NOT NULL,
+			config_refresh_token TEXT NOT NULL DEFAULT ''
+		)`,
+		`CREATE TABLE user_name_history (
+			id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+			user_id TEXT NOT NULL,
+			old_name TEXT NOT NULL,
+			new_name TEXT NOT NULL,
+			changed_at INTEGER NOT NULL,
+			FOREIGN KEY (user_id) REFERENCES "user"(id) ON DELETE CASCADE
+		)`,
+		`CREATE INDEX idx_user_name_history ON user_name_history(user_id)`,
+		`CREATE TABLE custom_command (
+			id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+			channel_id TEXT NOT NULL,
+			name TEXT NOT NULL,
+			response TEXT NOT NULL,
+			is_enabled BOOL NOT NULL DEFAULT true,
+			last_used INTEGER NOT NULL DEFAULT 0,
+			channel_cooldown INTEGER,
+			user_cooldown INTEGER,
+			UNIQUE (channel_id, name),
+			FOREIGN KEY (channel_id) REFERENCES "user"(id) ON DELETE CASCADE
+		)`,
+		`CREATE TABLE custom_command_data (
+			id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+			custom_command_id INTEGER NOT NULL,
+			user_id TEXT NOT NULL,
+			last_used INTEGER NOT NULL DEFAULT 0,
+			UNIQUE (custom_command_id, user_id),
+			FOREIGN KEY (custom_command_id) REFERENCES custom_command(id) ON DELETE CASCADE,
+			FOREIGN KEY (user_id) REFERENCES "user"(id) ON DELETE CASCADE
+		)`,
+		`CREATE TABLE command_counter (
+			id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+			channel_id TEXT NOT NULL,
+			name TEXT NOT NULL,
+			count INTEGER NOT NULL DEFAULT 0,
+			UNIQUE (channel_id, name),
+			FOREIGN KEY (channel_id) REFERENCES "user"(id) ON DELETE CASCADE
+		)`,
+		`CREATE TABLE channel_role (
+			id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+			channel_id TEXT NOT NULL,
+			user_id TEXT NOT NULL,
+			role TEXT NOT NULL,
+			UNIQUE (channel_id, user_id, role),
+			FOREIGN KEY (channel_id) REFERENCES "user"(id) ON DELETE CASCADE,
+			FOREIGN KEY (user_id) REFERENCES "user"(id) ON DELETE CASCADE
+		)`,
 
 		// DML
 		`INSERT INTO permission (name) VALUES ('user')`,
@@ -0,0 +1,38 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// TokenStore saves the bot's OAuth token in the oauth_token table, which holds a single row
+type TokenStore struct {
+	DB *sql.DB
+}
+
+// LoadToken returns sql.ErrNoRows if no token was saved yet
+func (s *TokenStore) LoadToken() (accessToken string, refreshToken string, configRefreshToken string, expiresAt time.Time, err error) {
+	var expiresAtUnix int64
+	err = s.DB.QueryRow("SELECT access_token, refresh_token, config_refresh_token, expires_at FROM oauth_token WHERE id = 1").
+		Scan(&accessToken, &refreshToken, &configRefreshToken, &expiresAtUnix)
+	if err != nil {
+		return "", "", "", time.Time{}, err
+	}
+	return accessToken, refreshToken, configRefreshToken, time.Unix(expiresAtUnix, 0), nil
+}
+
+func (s *TokenStore) SaveToken(accessToken string, refreshToken string, configRefreshToken string, expiresAt time.Time) error {
+	_, err := s.DB.Exec(`
+		INSERT INTO oauth_token (id, access_token, refresh_token, config_refresh_token, expires_at) VALUES (1, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			access_token = excluded.access_token,
+			refresh_token = excluded.refresh_token,
+			config_refresh_token = excluded.config_refresh_token,
+			expires_at = excluded.expires_at
+		`, accessToken, refreshToken, configRefreshToken, expiresAt.Unix())
+	if err != nil {
+		return fmt.Errorf("failed to save oauth token: %w", err)
+	}
+	return nil
+}
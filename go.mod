@@ -6,15 +6,22 @@ require (
 	github.com/Potat-Industries/go-potatFilters v0.1.3
 	github.com/douglascdev/buttifier v0.1.3
 	github.com/gempir/go-twitch-irc/v4 v4.2.0
+	github.com/jackc/pgx/v5 v5.7.6
 	github.com/ncruces/go-sqlite3 v0.18.2
 	github.com/rs/zerolog v1.33.0
 )
 
 require (
+	github.com/jackc/pgpassfile v1.0.0 // indirect
+	github.com/jackc/pgservicefile v0.0.0-20240606120523-5a60cdf6a761 // indirect
+	github.com/jackc/puddle/v2 v2.2.2 // indirect
 	github.com/mattn/go-colorable v0.1.13 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
 	github.com/ncruces/julianday v1.0.0 // indirect
 	github.com/speedata/hyphenation v1.0.2 // indirect
 	github.com/tetratelabs/wazero v1.8.0 // indirect
-	golang.org/x/sys v0.25.0 // indirect
+	golang.org/x/crypto v0.37.0 // indirect
+	golang.org/x/sync v0.13.0 // indirect
+	golang.org/x/sys v0.32.0 // indirect
+	golang.org/x/text v0.24.0 // indirect
 )
@@ -1,16 +1,21 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"flag"
+	"fmt"
 	"monkebot/command"
 	"monkebot/config"
 	"monkebot/database"
 	"monkebot/monkebot"
+	"monkebot/platform"
+	"monkebot/twitchapi"
 	"monkebot/types"
 	"os"
+	"os/signal"
 	"sort"
+	"syscall"
 	"time"
 
 	"github.com/rs/zerolog"
@@ -23,6 +28,19 @@ func main() {
 	debug := flag.Bool("debug", false, "sets log level to debug")
 	cmdListPrefix := flag.String("cmd-list-prefix", "\\", "sets the bot's prefix used in the command list generation")
 	generateCmdList := flag.String("cmd-list", "", "ignores all other args and generates command list json to the specified path")
+	console := flag.Bool("console", false, "reads chat messages from stdin and prints responses instead of connecting to Twitch")
+	consoleUser := flag.String("console-user", "console", "name of the chatter simulated in console mode")
+	consoleUserID := flag.String("console-user-id", "1", "id of the chatter simulated in console mode")
+	consoleChannel := flag.String("console-channel", "console", "name of the channel simulated in console mode")
+	consoleChannelID := flag.String("console-channel-id", "1", "id of the channel simulated in console mode")
+	sendQueueSize := flag.Int("send-queue-size", 100, "maximum number of outgoing messages waiting for the rate limit")
+	workers := flag.Int("workers", 4, "number of workers handling messages, messages in the same channel are always handled in order")
+	messageQueueSize := flag.Int("message-queue-size", 100, "maximum number of incoming messages waiting for each worker before new ones are dropped")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 10*time.Second, "how long to wait for running commands and queued messages when shutting down")
+	sendQueuePolicy := flag.String("send-queue-policy", "drop-oldest", "what to do with messages sent while the send queue is full: drop-newest, drop-oldest or block")
+	backupDir := flag.String("backup-dir", "", "directory where scheduled sqlite snapshots are saved, scheduled snapshots are disabled if empty")
+	backupInterval := flag.Duration("backup-interval", 24*time.Hour, "how often scheduled snapshots are saved")
+	backupKeep := flag.Int("backup-keep", 7, "number of scheduled snapshots kept in the backup directory, older ones are removed")
 	flag.Parse()
 
 	// set up logging
@@ -108,28 +126,138 @@ func main() {
 		log.Fatal().Err(err).Msg("failed to load config file")
 	}
 
-	reader := new(bytes.Buffer)
-	reader.Write(data)
-	writer, err := os.OpenFile(*cfgPath, os.O_TRUNC|os.O_WRONLY, 0644)
-	if err != nil {
-		log.Fatal().Err(err).Msg("failed to open config file for writing")
+	if flag.Arg(0) == "migrate" {
+		err = runMigrate(*cfg, flag.Args()[1:], os.Stdout)
+		if err != nil {
+			log.Fatal().Err(err).Msg("migrate failed")
+		}
+		return
+	}
+
+	if flag.Arg(0) == "backup" {
+		err = runBackup(*cfg, flag.Args()[1:], os.Stdout)
+		if err != nil {
+			log.Fatal().Err(err).Msg("backup failed")
+		}
+		return
 	}
-	db, err := database.InitDB(cfg.DBConfig.Driver, cfg.DBConfig.DataSourceName, reader, writer)
+
+	db, err := database.InitDB(cfg.DBConfig.Driver, cfg.DBConfig.DataSourceName, cfg.DBConfig.Version)
 	if err != nil {
 		log.Fatal().Err(err).Msg("failed to initialize database")
 	}
 
 	defer db.Close()
-	writer.Close()
+
+	if *console {
+		channel := types.Chatter{Name: *consoleChannel, ID: *consoleChannelID}
+		chatter := types.Chatter{
+			Name:          *consoleUser,
+			ID:            *consoleUserID,
+			IsBroadcaster: *consoleUserID == *consoleChannelID,
+		}
+		err = runConsole(*cfg, db, channel, chatter, *shutdownTimeout)
+		if err != nil {
+			log.Fatal().Err(err).Msg("console mode failed")
+		}
+		return
+	}
+
+	dropPolicy, err := platform.ParseDropPolicy(*sendQueuePolicy)
+	if err != nil {
+		log.Fatal().Err(err).Msg("invalid send queue policy")
+	}
+
+	tokens, err := twitchapi.NewTokenManager(*cfg, &database.TokenStore{DB: db})
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to initialize token manager")
+	}
+	err = tokens.Refresh()
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to refresh twitch token")
+	}
+
+	twitchChat := platform.NewTwitch(cfg.Login, tokens.AccessToken())
+	tokens.OnRefresh(twitchChat.SetToken)
+
+	tokenCtx, stopTokenRefresh := context.WithCancel(context.Background())
+	defer stopTokenRefresh()
+	go tokens.Run(tokenCtx)
+
+	if *backupDir != "" {
+		var dialect database.Dialect
+		dialect, err = database.DialectFor(cfg.DBConfig.Driver)
+		if err != nil {
+			log.Fatal().Err(err).Msg("invalid database driver")
+		}
+		if dialect.Driver != database.SQLite.Driver {
+			log.Fatal().Err(database.ErrSnapshotUnsupported).Msg("scheduled snapshots can't be enabled")
+		}
+		if *backupInterval <= 0 || *backupKeep < 1 {
+			log.Fatal().Msg("backup-interval and backup-keep must be positive")
+		}
+
+		err = os.MkdirAll(*backupDir, 0700)
+		if err != nil {
+			log.Fatal().Err(err).Str("dir", *backupDir).Msg("failed to create backup directory")
+		}
+
+		log.Info().Str("dir", *backupDir).Str("interval", backupInterval.String()).Int("keep", *backupKeep).Msg("scheduled snapshots enabled")
+		backupCtx, stopBackups := context.WithCancel(context.Background())
+		defer stopBackups()
+		go database.RunSnapshots(backupCtx, db, dialect, *backupDir, *backupInterval, *backupKeep)
+	}
+
+	chat := platform.NewSendQueue(twitchChat, platform.SendQueueOptions{
+		Size:   *sendQueueSize,
+		Policy: dropPolicy,
+		Limits: platform.TwitchRateLimits,
+	})
 
 	var mb *monkebot.Monkebot
-	mb, err = monkebot.NewMonkebot(*cfg, db)
+	mb, err = monkebot.NewMonkebot(*cfg, db, chat, twitchapi.NewClient(cfg.ClientID, tokens), monkebot.DispatcherOptions{
+		Workers:   *workers,
+		QueueSize: *messageQueueSize,
+	})
 	if err != nil {
 		log.Fatal().Err(err).Msg("failed to initialize monkebot")
 	}
 
-	err = mb.Connect()
+	err = run(mb, *shutdownTimeout)
 	if err != nil {
-		log.Fatal().Err(err).Msg("failed to connect to Twitch")
+		log.Err(err).Msg("bot stopped with an error")
 	}
 }
+
+// runs the bot until it disconnects or a SIGINT/SIGTERM is received, then shuts it down gracefully
+func run(mb *monkebot.Monkebot, shutdownTimeout time.Duration) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	connectErr := make(chan error, 1)
+	go func() {
+		connectErr <- mb.Connect()
+	}()
+
+	select {
+	case err := <-connectErr:
+		if err != nil {
+			return err
+		}
+		// the platform closed without errors, like the console reaching EOF, so let queued messages finish
+		log.Info().Str("timeout", shutdownTimeout.String()).Msg("disconnected, shutting down")
+	case <-ctx.Done():
+		log.Info().Str("timeout", shutdownTimeout.String()).Msg("received signal, shutting down")
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	err := mb.Shutdown(shutdownCtx)
+	if err != nil {
+		return fmt.Errorf("failed to shut down gracefully: %w", err)
+	}
+
+	log.Info().Msg("shut down successfully")
+	return nil
+}
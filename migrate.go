@@ -0,0 +1,111 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"monkebot/config"
+	"monkebot/database"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+const migrateUsage = "usage: monkebot [flags] migrate status|up|down [steps]|dry-run|check"
+
+// runs the migrate subcommand, which manages the database's migrations without starting the bot
+func runMigrate(cfg config.Config, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	// doesn't need the configured database
+	if args[0] == "check" {
+		return checkDrift(out)
+	}
+
+	dialect, err := database.DialectFor(cfg.DBConfig.Driver)
+	if err != nil {
+		return err
+	}
+
+	db, err := database.OpenDB(cfg.DBConfig.Driver, cfg.DBConfig.DataSourceName)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	switch args[0] {
+	case "status":
+		return printMigrationStatus(db, out)
+	case "up":
+		return database.Migrate(db, dialect, &database.Migrations, cfg.DBConfig.Version)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of steps '%s', %s", args[1], migrateUsage)
+			}
+		}
+		return database.MigrateDown(db, dialect, &database.Migrations, steps)
+	case "dry-run":
+		return database.DryRun(db, dialect, &database.Migrations, cfg.DBConfig.Version, out)
+	}
+
+	return fmt.Errorf("unknown migrate command '%s', %s", args[0], migrateUsage)
+}
+
+func printMigrationStatus(db *sql.DB, out io.Writer) error {
+	statuses, err := database.SelectMigrationStatus(db, &database.Migrations)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tSTATUS\tAPPLIED AT\tDOWN")
+	for _, status := range statuses {
+		state := "pending"
+		switch {
+		case status.Unknown:
+			state = "unknown"
+		case status.Changed:
+			state = "changed"
+		case status.Applied:
+			state = "applied"
+		}
+
+		var appliedAt string
+		if status.Applied {
+			appliedAt = status.AppliedAt.Format(time.DateTime)
+		}
+
+		down := "no"
+		if status.HasDown {
+			down = "yes"
+		}
+
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", status.Version, state, appliedAt, down)
+	}
+
+	return w.Flush()
+}
+
+// prints the differences between fresh and migrated databases, returning an error if there are any
+func checkDrift(out io.Writer) error {
+	drifts, err := database.CheckDrift(&database.Migrations)
+	if err != nil {
+		return err
+	}
+
+	if len(drifts) == 0 {
+		fmt.Fprintln(out, "no schema drift between fresh and migrated databases")
+		return nil
+	}
+
+	for _, drift := range drifts {
+		fmt.Fprintln(out, drift)
+	}
+	return fmt.Errorf("found %d differences between fresh and migrated databases", len(drifts))
+}
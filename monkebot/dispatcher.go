@@ -0,0 +1,110 @@
+package monkebot
+
+import (
+	"context"
+	"hash/fnv"
+	"monkebot/types"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+type DispatcherOptions struct {
+	Workers int
+	// QueueSize is the maximum number of messages waiting for each worker
+	QueueSize int
+}
+
+type queuedMessage struct {
+	message  *types.Message
+	queuedAt time.Time
+}
+
+// Dispatcher handles messages in a pool of workers.
+// Messages from the same channel always go to the same worker, so they're handled in order,
+// while messages from different channels may be handled in parallel.
+type Dispatcher struct {
+	queues []chan queuedMessage
+	handle func(message *types.Message, queueLatency time.Duration)
+	wg     sync.WaitGroup
+	mu     sync.RWMutex
+	closed bool
+}
+
+func NewDispatcher(opts DispatcherOptions, handle func(message *types.Message, queueLatency time.Duration)) *Dispatcher {
+	d := &Dispatcher{
+		queues: make([]chan queuedMessage, max(1, opts.Workers)),
+		handle: handle,
+	}
+
+	for i := range d.queues {
+		d.queues[i] = make(chan queuedMessage, max(1, opts.QueueSize))
+		d.wg.Add(1)
+		go d.work(d.queues[i])
+	}
+
+	return d
+}
+
+func (d *Dispatcher) work(queue chan queuedMessage) {
+	defer d.wg.Done()
+	for queued := range queue {
+		d.handle(queued.message, time.Since(queued.queuedAt))
+	}
+}
+
+// Dispatch queues the message to be handled by its channel's worker.
+// Returns false if the dispatcher is closed or the worker's queue is full and the message was dropped.
+func (d *Dispatcher) Dispatch(message *types.Message) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if d.closed {
+		log.Debug().Str("channel", message.Channel).Str("msg", message.Message).Msg("ignored message during shutdown")
+		return false
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(message.Channel))
+	worker := int(h.Sum32() % uint32(len(d.queues)))
+
+	select {
+	case d.queues[worker] <- queuedMessage{message: message, queuedAt: time.Now()}:
+		return true
+	default:
+		log.Warn().
+			Str("channel", message.Channel).
+			Str("user", message.Chatter.Name).
+			Str("msg", message.Message).
+			Int("worker", worker).
+			Int("queueDepth", len(d.queues[worker])).
+			Msg("message queue full, dropped message")
+		return false
+	}
+}
+
+// Close stops accepting messages and waits until the queued ones are handled or ctx is done
+func (d *Dispatcher) Close(ctx context.Context) error {
+	d.mu.Lock()
+	if !d.closed {
+		d.closed = true
+		for _, queue := range d.queues {
+			close(queue)
+		}
+	}
+	d.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,93 @@
+package monkebot
+
+import (
+	"context"
+	"monkebot/types"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDispatcherChannelOrder(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		handled = make(map[string][]string)
+	)
+	d := NewDispatcher(DispatcherOptions{Workers: 4, QueueSize: 100}, func(message *types.Message, queueLatency time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		handled[message.Channel] = append(handled[message.Channel], message.Message)
+	})
+
+	expected := []string{"1", "2", "3", "4", "5"}
+	for _, msg := range expected {
+		for _, channel := range []string{"a", "b", "c"} {
+			if !d.Dispatch(&types.Message{Channel: channel, Message: msg}) {
+				t.Fatalf("message %s in channel %s was dropped", msg, channel)
+			}
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := d.Close(ctx); err != nil {
+		t.Fatalf("failed to close dispatcher: %v", err)
+	}
+
+	for channel, messages := range handled {
+		if len(messages) != len(expected) {
+			t.Fatalf("expected %d messages in channel %s, got %d", len(expected), channel, len(messages))
+		}
+		for i := range expected {
+			if messages[i] != expected[i] {
+				t.Errorf("messages handled out of order in channel %s: %v", channel, messages)
+				break
+			}
+		}
+	}
+}
+
+func TestDispatcherParallelChannels(t *testing.T) {
+	block := make(chan struct{})
+	handled := make(chan string, 1)
+	d := NewDispatcher(DispatcherOptions{Workers: 2, QueueSize: 10}, func(message *types.Message, queueLatency time.Duration) {
+		if message.Message == "slow" {
+			<-block
+			return
+		}
+		handled <- message.Channel
+	})
+	defer close(block)
+
+	// find two channels handled by different workers
+	d.Dispatch(&types.Message{Channel: "a", Message: "slow"})
+	for _, channel := range []string{"b", "c", "d", "e", "f"} {
+		d.Dispatch(&types.Message{Channel: channel, Message: "fast"})
+		select {
+		case <-handled:
+			return
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+	t.Errorf("a slow message blocked every channel")
+}
+
+func TestDispatcherShedsLoad(t *testing.T) {
+	block := make(chan struct{})
+	d := NewDispatcher(DispatcherOptions{Workers: 1, QueueSize: 1}, func(message *types.Message, queueLatency time.Duration) {
+		<-block
+	})
+	defer close(block)
+
+	dropped := 0
+	for range 5 {
+		if !d.Dispatch(&types.Message{Channel: "a"}) {
+			dropped++
+		}
+	}
+
+	// one message is being handled and one is queued
+	if dropped < 3 {
+		t.Errorf("expected at least 3 dropped messages, got %d", dropped)
+	}
+}
@@ -1,73 +1,44 @@
 package monkebot
 
 import (
+	"context"
 	"database/sql"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"monkebot/command"
 	"monkebot/config"
 	"monkebot/database"
+	"monkebot/platform"
 	"monkebot/twitchapi"
 	"monkebot/types"
-	"net/http"
-	"net/url"
+	"monkebot/users"
 	"slices"
+	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/douglascdev/buttifier"
 	"github.com/rs/zerolog/log"
 
 	"github.com/Potat-Industries/go-potatFilters"
-	"github.com/gempir/go-twitch-irc/v4"
 )
 
 type Monkebot struct {
-	TwitchClient *twitch.Client
-	Cfg          config.Config
-	db           *sql.DB
-	startTime    time.Time
-	buttifier    *buttifier.Buttifier
+	Platform   platform.ChatPlatform
+	Cfg        config.Config
+	db         *sql.DB
+	startTime  time.Time
+	buttifier  *buttifier.Buttifier
+	dispatcher *Dispatcher
 }
 
-func refreshTwitchToken(cfg config.Config) (*string, error) {
-	resp, err := http.PostForm("https://id.twitch.tv/oauth2/token", url.Values{
-		"client_id":     {cfg.ClientID},
-		"client_secret": {cfg.ClientSecret},
-		"refresh_token": {cfg.RefreshToken},
-		"grant_type":    {"refresh_token"},
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch oauth token from twitch client secret: %w", err)
-	}
-	defer resp.Body.Close()
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read token response body: %w", err)
-	}
-	var respMap map[string]json.RawMessage
-	err = json.Unmarshal(body, &respMap)
-	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal oauth token response: %w", err)
-	}
-	var token string
-	err = json.Unmarshal(respMap["access_token"], &token)
-	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal token value: %w", err)
-	}
-
-	return &token, nil
+// implemented by platforms that buffer outgoing messages, like platform.SendQueue
+type flusher interface {
+	Flush(ctx context.Context) error
 }
 
-func NewMonkebot(cfg config.Config, db *sql.DB) (*Monkebot, error) {
-	token, err := refreshTwitchToken(cfg)
-	if err != nil {
-		return nil, fmt.Errorf("failed to refresh twitch token: %w", err)
-	}
-	client := twitch.NewClient(cfg.Login, "oauth:"+*token)
-
+func NewMonkebot(cfg config.Config, db *sql.DB, chat platform.ChatPlatform, helix *twitchapi.Client, dispatcherOpts DispatcherOptions) (*Monkebot, error) {
 	butt, err := buttifier.New()
 	butt.ButtificationProbability = 0.05
 	butt.ButtificationRate = 0.2
@@ -76,19 +47,30 @@ func NewMonkebot(cfg config.Config, db *sql.DB) (*Monkebot, error) {
 	}
 
 	mb := &Monkebot{
-		TwitchClient: client,
-		Cfg:          cfg,
-		db:           db,
-		startTime:    time.Now(),
-		buttifier:    butt,
+		Platform:  chat,
+		Cfg:       cfg,
+		db:        db,
+		startTime: time.Now(),
+		buttifier: butt,
 	}
 
-	client.OnPrivateMessage(func(message twitch.PrivateMessage) {
+	resolver := users.NewResolver(helix, users.DefaultTTL)
+	mb.dispatcher = NewDispatcher(dispatcherOpts, func(message *types.Message, queueLatency time.Duration) {
 		startTime := time.Now()
-		normalizedMsg := types.NewMessage(message, db, &cfg)
-		err := command.HandleCommands(normalizedMsg, mb, &cfg)
+		message.DB = db
+		message.Cfg = &cfg
+		message.Helix = helix
+		message.Users = resolver
+		err := resolver.RecordNames(db,
+			users.User{ID: message.Chatter.ID, Name: message.Chatter.Name},
+			users.User{ID: message.RoomID, Name: message.Channel},
+		)
+		if err != nil {
+			log.Err(err).Str("user", message.Chatter.Name).Str("channel", message.Channel).Msg("failed to record user names")
+		}
+		err = command.HandleCommands(message, mb, &cfg)
 		if errors.Is(err, command.UnknownCommandErr) {
-			log.Warn().Str("user", message.User.Name).Str("msg", message.Message).Msg("unknown command")
+			log.Warn().Str("user", message.Chatter.Name).Str("msg", message.Message).Msg("unknown command")
 			mb.Say(message.Channel, "❌Unknown command", struct {
 				Param types.SenderParam
 				Value string
@@ -105,13 +87,18 @@ func NewMonkebot(cfg config.Config, db *sql.DB) (*Monkebot, error) {
 		internalLatency := fmt.Sprintf("%d ms", time.Since(startTime).Milliseconds())
 		log.Info().
 			Str("channel", message.Channel).
-			Str("user", message.User.Name).
+			Str("user", message.Chatter.Name).
 			Str("msg", message.Message).
 			Str("internalLatency", internalLatency).
+			Str("queueLatency", fmt.Sprintf("%d ms", queueLatency.Milliseconds())).
 			Msg("new message")
 	})
 
-	client.OnConnect(func() {
+	chat.OnMessage(func(message *types.Message) {
+		mb.dispatcher.Dispatch(message)
+	})
+
+	chat.OnConnect(func() {
 		log.Info().
 			Str("login", cfg.Login).
 			Msg("connected to Twitch")
@@ -122,24 +109,42 @@ func NewMonkebot(cfg config.Config, db *sql.DB) (*Monkebot, error) {
 		}
 		defer tx.Rollback()
 
+		hasCommands, err := database.SelectHasCommands(tx)
+		if err != nil {
+			log.Err(err).Msg("failed to check if the initial inserts are done")
+			return
+		}
+
 		// initial inserts are done, just join saved channels
-		if cfg.DBConfig.Version != 0 {
-			var savedChannels []string
+		if hasCommands {
+			var savedChannels []struct{ ID, Name string }
 			savedChannels, err = database.SelectJoinedChannels(tx)
 			if err != nil {
 				log.Err(err).Msg("failed to get saved channels")
+				return
 			}
-			mb.Join(savedChannels...)
-			log.Info().Strs("channels", savedChannels).Msg("successfully joined saved channels")
+
+			var channelNames []string
+			channelNames, err = currentChannelNames(tx, helix, savedChannels)
+			if err != nil {
+				log.Err(err).Msg("failed to update renamed channels")
+				return
+			}
+
+			err = tx.Commit()
+			if err != nil {
+				log.Err(err).Msg("failed to commit transaction")
+				return
+			}
+
+			mb.Join(channelNames...)
+			log.Info().Strs("channels", channelNames).Msg("successfully joined saved channels")
 			return
 		}
 
 		mb.Join(cfg.InitialChannels...)
 
-		var cmdNames []string
-		for _, cmd := range command.Commands {
-			cmdNames = append(cmdNames, cmd.Name)
-		}
+		cmdNames := command.Names()
 
 		err = database.InsertCommands(tx, cmdNames...)
 		if err != nil {
@@ -147,8 +152,8 @@ func NewMonkebot(cfg config.Config, db *sql.DB) (*Monkebot, error) {
 			return
 		}
 
-		var helixUsers *[]twitchapi.HelixUser
-		helixUsers, err = twitchapi.GetUserByName(&cfg, cfg.InitialChannels...)
+		var helixUsers []twitchapi.HelixUser
+		helixUsers, err = helix.GetUsersByName(cfg.InitialChannels...)
 		if err != nil {
 			log.Err(err).Strs("channels", cfg.InitialChannels).Msg("failed to get helix data for users")
 			return
@@ -158,7 +163,7 @@ func NewMonkebot(cfg config.Config, db *sql.DB) (*Monkebot, error) {
 			ID   string
 			Name string
 		}
-		for _, twitchUser := range *helixUsers {
+		for _, twitchUser := range helixUsers {
 			users = append(users, struct {
 				ID   string
 				Name string
@@ -175,14 +180,14 @@ func NewMonkebot(cfg config.Config, db *sql.DB) (*Monkebot, error) {
 			if !slices.Contains(cfg.AdminUsernames, user.Name) {
 				continue
 			}
-			err = database.UpdateUserPermission(tx, user.Name, "admin")
+			err = database.UpdateUserPermission(tx, user.ID, "admin")
 			if err != nil {
 				log.Err(err).Str("name", user.Name).Str("id", user.ID).Msg("failed to insert user commands for user")
 				return
 			}
 		}
 
-		for _, twitchUser := range *helixUsers {
+		for _, twitchUser := range helixUsers {
 			err = database.InsertUserCommands(tx, twitchUser.ID, cmdNames...)
 			if err != nil {
 				log.Err(err).Str("name", twitchUser.Login).Str("id", twitchUser.ID).Msg("failed to insert user commands for user")
@@ -199,28 +204,93 @@ func NewMonkebot(cfg config.Config, db *sql.DB) (*Monkebot, error) {
 		log.Info().Msg("successfully inserted initial channels")
 	})
 
-	client.OnSelfJoinMessage(func(message twitch.UserJoinMessage) {
-		log.Info().Str("channel", message.Channel).Msg("joined channel")
+	chat.OnSelfJoin(func(channel string) {
+		log.Info().Str("channel", channel).Msg("joined channel")
 	})
 
-	client.OnSelfPartMessage(func(message twitch.UserPartMessage) {
-		log.Info().Str("channel", message.Channel).Msg("parted channel")
+	chat.OnSelfPart(func(channel string) {
+		log.Info().Str("channel", channel).Msg("parted channel")
 	})
 	return mb, nil
 }
 
+// Looks up the saved channels by id and updates the names of the ones that were renamed, returning their current names.
+// If Helix can't be reached, the saved names are returned.
+func currentChannelNames(tx *sql.Tx, helix *twitchapi.Client, channels []struct{ ID, Name string }) ([]string, error) {
+	names := make([]string, 0, len(channels))
+	if len(channels) == 0 {
+		return names, nil
+	}
+
+	ids := make([]string, len(channels))
+	for i, channel := range channels {
+		ids[i] = channel.ID
+	}
+
+	helixUsers, err := helix.GetUsersByID(ids...)
+	if err != nil {
+		log.Err(err).Msg("failed to get current channel names, joining saved names")
+		for _, channel := range channels {
+			names = append(names, channel.Name)
+		}
+		return names, nil
+	}
+
+	found := make(map[string]bool, len(helixUsers))
+	for _, helixUser := range helixUsers {
+		_, err = database.UpdateUserName(tx, helixUser.ID, helixUser.Login)
+		if err != nil {
+			return nil, err
+		}
+		found[helixUser.ID] = true
+		names = append(names, helixUser.Login)
+	}
+
+	for _, channel := range channels {
+		if !found[channel.ID] {
+			log.Warn().Str("id", channel.ID).Str("name", channel.Name).Msg("saved channel not found on twitch, not joining")
+		}
+	}
+
+	return names, nil
+}
+
 func (t *Monkebot) Connect() error {
-	return t.TwitchClient.Connect()
+	return t.Platform.Connect()
+}
+
+// Shutdown stops handling new messages, waits for the ones being handled to finish,
+// sends queued messages and disconnects from the platform.
+// If ctx is done before the handlers finish, the platform is disconnected anyway and ctx.Err() is returned.
+func (t *Monkebot) Shutdown(ctx context.Context) error {
+	var err error
+	if err = t.dispatcher.Close(ctx); err != nil {
+		err = fmt.Errorf("timed out waiting for in-flight messages: %w", err)
+	} else {
+		log.Info().Msg("finished handling in-flight messages")
+	}
+
+	if f, ok := t.Platform.(flusher); ok && err == nil {
+		err = f.Flush(ctx)
+		if err != nil {
+			err = fmt.Errorf("failed to flush outgoing messages: %w", err)
+		}
+	}
+
+	disconnectErr := t.Platform.Disconnect()
+	if disconnectErr != nil {
+		return errors.Join(err, fmt.Errorf("failed to disconnect: %w", disconnectErr))
+	}
+
+	return err
 }
 
 func (t *Monkebot) Join(channels ...string) {
-	t.TwitchClient.Join(channels...)
+	t.Platform.Join(channels...)
 }
 
 func (t *Monkebot) Part(channels ...string) {
-	for _, channel := range channels {
-		t.TwitchClient.Depart(channel)
-	}
+	t.Platform.Part(channels...)
 }
 
 func (t *Monkebot) Say(channel string, message string, params ...struct {
@@ -253,36 +323,99 @@ func (t *Monkebot) Say(channel string, message string, params ...struct {
 			Str("channel", channel).
 			Str("msg", message).
 			Msg("message filtered")
-		t.TwitchClient.Say(channel, "⚠ Message withheld for containing a banned phrase...")
+		t.Platform.Say(channel, "⚠ Message withheld for containing a banned phrase...")
 		return
 	}
 
 	// send response
-	var response strings.Builder
+	var prefix strings.Builder
 	if me {
 		const meStr = "/me "
-		response.WriteString(meStr)
+		prefix.WriteString(meStr)
 	}
 
 	const invisPrefix = "󠀀 " // prevents command injection
-	response.WriteString(invisPrefix)
+	prefix.WriteString(invisPrefix)
 
-	response.WriteString(message)
+	parts := splitMessage(message, utf8.RuneCountInString(prefix.String()), maxMessageLength)
+	for i, part := range parts {
+		s := prefix.String() + part
 
-	s := response.String()
+		// only the first part is a reply so the rest doesn't repeat the reply header
+		if replyMessageID != "" && i == 0 {
+			log.Debug().Str("channel", channel).Str("replyMessageID", replyMessageID).Str("msg", s).Msg("replying")
+			t.Platform.Reply(channel, replyMessageID, s)
+			continue
+		}
 
-	if replyMessageID != "" {
-		log.Debug().Str("channel", channel).Str("replyMessageID", replyMessageID).Str("msg", s).Msg("replying")
-		t.TwitchClient.Reply(channel, replyMessageID, s)
-		return
+		log.Debug().Str("channel", channel).Str("msg", s).Msg("sending message")
+		t.Platform.Say(channel, s)
+	}
+}
+
+// Twitch rejects messages longer than this, in characters
+const maxMessageLength = 500
+
+// Splits message at word boundaries into parts that fit in maxLength characters after adding a
+// prefix of prefixLength characters. When more than one part is needed, parts are numbered like "(1/3) ".
+func splitMessage(message string, prefixLength int, maxLength int) []string {
+	if utf8.RuneCountInString(message)+prefixLength <= maxLength {
+		return []string{message}
+	}
+
+	// the numbering takes more space as the number of parts grows, so retry with more digits until it fits
+	for digits := 1; ; digits++ {
+		numberingLength := len("(/) ") + 2*digits
+		parts := wrapWords(message, max(1, maxLength-prefixLength-numberingLength))
+		if len(strconv.Itoa(len(parts))) > digits {
+			continue
+		}
+
+		for i := range parts {
+			parts[i] = fmt.Sprintf("(%d/%d) %s", i+1, len(parts), parts[i])
+		}
+		return parts
+	}
+}
+
+// Splits message into lines of at most width characters, breaking words only if they don't fit in a line
+func wrapWords(message string, width int) []string {
+	var (
+		parts  []string
+		line   []rune
+		runes  []rune
+		length int
+	)
+	for _, word := range strings.Fields(message) {
+		runes = []rune(word)
+		length = len(runes)
+		if len(line) > 0 && len(line)+1+length <= width {
+			line = append(line, ' ')
+			line = append(line, runes...)
+			continue
+		}
+
+		if len(line) > 0 {
+			parts = append(parts, string(line))
+			line = nil
+		}
+
+		for len(runes) > width {
+			parts = append(parts, string(runes[:width]))
+			runes = runes[width:]
+		}
+		line = runes
+	}
+
+	if len(line) > 0 {
+		parts = append(parts, string(line))
 	}
 
-	log.Debug().Str("channel", channel).Str("msg", s).Msg("sending message")
-	t.TwitchClient.Say(channel, s)
+	return parts
 }
 
 func (t *Monkebot) Ping() (duration time.Duration, err error) {
-	duration, err = t.TwitchClient.Latency()
+	duration, err = t.Platform.Latency()
 	return
 }
 
@@ -0,0 +1,149 @@
+package monkebot
+
+import (
+	"context"
+	"fmt"
+	"monkebot/config"
+	"monkebot/types"
+	"strings"
+	"testing"
+	"time"
+)
+
+type sentMessage struct {
+	Channel         string
+	ParentMessageID string
+	Message         string
+}
+
+// implementation of platform.ChatPlatform for testing
+type fakePlatform struct {
+	sent      []sentMessage
+	joined    []string
+	onMessage func(message *types.Message)
+}
+
+func (f *fakePlatform) Connect() error    { return nil }
+func (f *fakePlatform) Disconnect() error { return nil }
+func (f *fakePlatform) Join(channels ...string) {
+	f.joined = append(f.joined, channels...)
+}
+func (f *fakePlatform) Part(channels ...string) {}
+func (f *fakePlatform) Say(channel string, message string) {
+	f.sent = append(f.sent, sentMessage{Channel: channel, Message: message})
+}
+
+func (f *fakePlatform) Reply(channel string, parentMessageID string, message string) {
+	f.sent = append(f.sent, sentMessage{Channel: channel, ParentMessageID: parentMessageID, Message: message})
+}
+func (f *fakePlatform) Latency() (time.Duration, error)                 { return 0, nil }
+func (f *fakePlatform) IsModerator(channel string) bool                 { return false }
+func (f *fakePlatform) OnConnect(callback func())                       {}
+func (f *fakePlatform) OnMessage(callback func(message *types.Message)) { f.onMessage = callback }
+func (f *fakePlatform) OnSelfJoin(callback func(channel string))        {}
+func (f *fakePlatform) OnSelfPart(callback func(channel string))        {}
+
+func newTestMonkebot(t *testing.T) (*Monkebot, *fakePlatform) {
+	chat := &fakePlatform{}
+	mb, err := NewMonkebot(config.Config{Login: "monkebot", Prefix: "!"}, nil, chat, nil, DispatcherOptions{Workers: 1, QueueSize: 1})
+	if err != nil {
+		t.Fatalf("failed to create monkebot: %v", err)
+	}
+	return mb, chat
+}
+
+func TestSay(t *testing.T) {
+	mb, chat := newTestMonkebot(t)
+
+	mb.Say("test", "hello")
+	if len(chat.sent) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(chat.sent))
+	}
+	if !strings.HasSuffix(chat.sent[0].Message, "hello") || chat.sent[0].Message == "hello" {
+		t.Errorf("expected prefixed message, got '%s'", chat.sent[0].Message)
+	}
+
+	mb.Say("test", "hi", struct {
+		Param types.SenderParam
+		Value string
+	}{types.ReplyMessageID, "abc"})
+	if chat.sent[1].ParentMessageID != "abc" {
+		t.Errorf("expected reply to 'abc', got '%s'", chat.sent[1].ParentMessageID)
+	}
+
+	mb.Say("test", "")
+	if len(chat.sent) != 2 {
+		t.Errorf("expected empty message to be ignored")
+	}
+}
+
+func TestSplitMessage(t *testing.T) {
+	if parts := splitMessage("short message", 2, 500); len(parts) != 1 || parts[0] != "short message" {
+		t.Errorf("expected short message to not be split, got %v", parts)
+	}
+
+	words := make([]string, 300)
+	for i := range words {
+		words[i] = "word"
+	}
+	message := strings.Join(words, " ")
+
+	parts := splitMessage(message, 6, 100)
+	for i, part := range parts {
+		if length := len([]rune(part)) + 6; length > 100 {
+			t.Errorf("part %d has %d characters, more than the limit", i, length)
+		}
+		if !strings.HasPrefix(part, fmt.Sprintf("(%d/%d) ", i+1, len(parts))) {
+			t.Errorf("part %d is not numbered: '%s'", i, part)
+		}
+		if strings.HasSuffix(part, "wor") {
+			t.Errorf("part %d was split in the middle of a word: '%s'", i, part)
+		}
+	}
+
+	// words longer than the limit are split
+	parts = splitMessage(strings.Repeat("a", 30), 0, 20)
+	if len(parts) != 3 || parts[0] != "(1/3) "+strings.Repeat("a", 14) {
+		t.Errorf("expected long word to be split in 3 parts, got %v", parts)
+	}
+}
+
+func TestSayLongMessage(t *testing.T) {
+	mb, chat := newTestMonkebot(t)
+
+	mb.Say("test", strings.Repeat("banana ", 150), struct {
+		Param types.SenderParam
+		Value string
+	}{types.ReplyMessageID, "abc"})
+
+	if len(chat.sent) < 2 {
+		t.Fatalf("expected long message to be split, got %d messages", len(chat.sent))
+	}
+	for i, sent := range chat.sent {
+		if len([]rune(sent.Message)) > maxMessageLength {
+			t.Errorf("message %d is longer than %d characters", i, maxMessageLength)
+		}
+		if i == 0 && sent.ParentMessageID != "abc" {
+			t.Errorf("expected first part to be a reply")
+		}
+		if i > 0 && sent.ParentMessageID != "" {
+			t.Errorf("expected only the first part to be a reply, part %d replied to %s", i, sent.ParentMessageID)
+		}
+	}
+}
+
+func TestShutdownIgnoresNewMessages(t *testing.T) {
+	mb, chat := newTestMonkebot(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := mb.Shutdown(ctx); err != nil {
+		t.Fatalf("failed to shut down: %v", err)
+	}
+
+	// the test bot has no database, so handling the message would panic
+	chat.onMessage(&types.Message{Channel: "test", Message: "!ping"})
+	if len(chat.sent) != 0 {
+		t.Errorf("expected no responses after shutdown, got %v", chat.sent)
+	}
+}
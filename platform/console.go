@@ -0,0 +1,196 @@
+package platform
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"monkebot/types"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const consoleHelp = `console directives:
+  /user <name> [id]       change the simulated chatter
+  /mod [on|off]           toggle or set the chatter's moderator flag
+  /vip [on|off]           toggle or set the chatter's VIP flag
+  /broadcaster [on|off]   toggle or set the chatter's broadcaster flag
+  /status                 show the simulated chatter and channel
+  /quit                   exit the console
+any other line is sent to the bot as a chat message`
+
+// Console is a ChatPlatform that reads chat messages from a reader and writes
+// the bot's responses to a writer, so commands can be tried locally without Twitch.
+//
+// Lines starting with / are console directives, see consoleHelp.
+type Console struct {
+	Channel string
+	RoomID  string
+	Chatter types.Chatter
+
+	in        io.Reader
+	out       io.Writer
+	msgCount  int
+	closed    atomic.Bool
+	onConnect func()
+	onMessage func(message *types.Message)
+	onJoin    func(channel string)
+	onPart    func(channel string)
+}
+
+func NewConsole(in io.Reader, out io.Writer, channel types.Chatter, chatter types.Chatter) *Console {
+	return &Console{
+		Channel: channel.Name,
+		RoomID:  channel.ID,
+		Chatter: chatter,
+		in:      in,
+		out:     out,
+	}
+}
+
+// Connect reads lines until EOF, /quit or Disconnect is called
+func (c *Console) Connect() error {
+	fmt.Fprintln(c.out, consoleHelp)
+	if c.onConnect != nil {
+		c.onConnect()
+	}
+
+	scanner := bufio.NewScanner(c.in)
+	c.prompt()
+	for !c.closed.Load() && scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+		case line == "/quit":
+			return nil
+		case strings.HasPrefix(line, "/"):
+			if err := c.runDirective(line); err != nil {
+				fmt.Fprintf(c.out, "error: %s\n", err)
+			}
+		case c.onMessage != nil:
+			c.msgCount++
+			c.onMessage(&types.Message{
+				ID:      "console-" + strconv.Itoa(c.msgCount),
+				Message: line,
+				Time:    time.Now(),
+				Channel: c.Channel,
+				RoomID:  c.RoomID,
+				Chatter: c.Chatter,
+			})
+		}
+		c.prompt()
+	}
+
+	return scanner.Err()
+}
+
+func (c *Console) prompt() {
+	fmt.Fprintf(c.out, "%s@#%s> ", c.Chatter.Name, c.Channel)
+}
+
+func (c *Console) runDirective(line string) error {
+	args := strings.Fields(line)
+
+	setFlag := func(flag *bool) error {
+		switch {
+		case len(args) == 1:
+			*flag = !*flag
+		case args[1] == "on":
+			*flag = true
+		case args[1] == "off":
+			*flag = false
+		default:
+			return fmt.Errorf("expected 'on' or 'off', got '%s'", args[1])
+		}
+		c.printStatus()
+		return nil
+	}
+
+	switch args[0] {
+	case "/user":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: /user <name> [id]")
+		}
+		c.Chatter.Name = args[1]
+		c.Chatter.ID = args[1]
+		if len(args) > 2 {
+			c.Chatter.ID = args[2]
+		}
+		c.printStatus()
+	case "/mod":
+		return setFlag(&c.Chatter.IsMod)
+	case "/vip":
+		return setFlag(&c.Chatter.IsVIP)
+	case "/broadcaster":
+		return setFlag(&c.Chatter.IsBroadcaster)
+	case "/status":
+		c.printStatus()
+	case "/help":
+		fmt.Fprintln(c.out, consoleHelp)
+	default:
+		return fmt.Errorf("unknown directive '%s', type /help for the list of directives", args[0])
+	}
+
+	return nil
+}
+
+func (c *Console) printStatus() {
+	fmt.Fprintf(c.out, "chatter=%s id=%s mod=%t vip=%t broadcaster=%t channel=%s room=%s\n",
+		c.Chatter.Name, c.Chatter.ID, c.Chatter.IsMod, c.Chatter.IsVIP, c.Chatter.IsBroadcaster, c.Channel, c.RoomID)
+}
+
+func (c *Console) Disconnect() error {
+	c.closed.Store(true)
+	return nil
+}
+
+func (c *Console) Join(channels ...string) {
+	for _, channel := range channels {
+		fmt.Fprintf(c.out, "* joined #%s\n", channel)
+		if c.onJoin != nil {
+			c.onJoin(channel)
+		}
+	}
+}
+
+func (c *Console) Part(channels ...string) {
+	for _, channel := range channels {
+		fmt.Fprintf(c.out, "* parted #%s\n", channel)
+		if c.onPart != nil {
+			c.onPart(channel)
+		}
+	}
+}
+
+func (c *Console) Say(channel string, message string) {
+	fmt.Fprintf(c.out, "#%s: %s\n", channel, message)
+}
+
+func (c *Console) Reply(channel string, parentMessageID string, message string) {
+	fmt.Fprintf(c.out, "#%s (reply to %s): %s\n", channel, parentMessageID, message)
+}
+
+func (c *Console) Latency() (time.Duration, error) {
+	return 0, nil
+}
+
+func (c *Console) IsModerator(channel string) bool {
+	return false
+}
+
+func (c *Console) OnConnect(callback func()) {
+	c.onConnect = callback
+}
+
+func (c *Console) OnMessage(callback func(message *types.Message)) {
+	c.onMessage = callback
+}
+
+func (c *Console) OnSelfJoin(callback func(channel string)) {
+	c.onJoin = callback
+}
+
+func (c *Console) OnSelfPart(callback func(channel string)) {
+	c.onPart = callback
+}
@@ -0,0 +1,95 @@
+package platform
+
+import (
+	"bytes"
+	"monkebot/types"
+	"strings"
+	"testing"
+)
+
+// Runs the console on the input lines, returning the messages sent to the bot and the console's output
+func runConsole(t *testing.T, lines ...string) ([]*types.Message, string) {
+	var (
+		out      bytes.Buffer
+		messages []*types.Message
+	)
+	console := NewConsole(strings.NewReader(strings.Join(lines, "\n")), &out,
+		types.Chatter{Name: "channel", ID: "1"}, types.Chatter{Name: "alice", ID: "77"})
+	console.OnMessage(func(message *types.Message) {
+		messages = append(messages, message)
+	})
+
+	err := console.Connect()
+	if err != nil {
+		t.Fatalf("failed to run console: %v", err)
+	}
+	return messages, out.String()
+}
+
+func TestConsoleDirectives(t *testing.T) {
+	tests := []struct {
+		name     string
+		lines    []string
+		expected []types.Chatter // chatter of each message sent to the bot
+	}{
+		{"no directives", []string{"!ping", "", "  hi  "}, []types.Chatter{
+			{Name: "alice", ID: "77"},
+			{Name: "alice", ID: "77"},
+		}},
+		{"user", []string{"/user bob", "!ping", "/user carol 42", "!ping"}, []types.Chatter{
+			{Name: "bob", ID: "bob"},
+			{Name: "carol", ID: "42"},
+		}},
+		{"toggled badges", []string{"/mod", "!ping", "/vip", "/broadcaster", "!ping", "/mod", "!ping"}, []types.Chatter{
+			{Name: "alice", ID: "77", IsMod: true},
+			{Name: "alice", ID: "77", IsMod: true, IsVIP: true, IsBroadcaster: true},
+			{Name: "alice", ID: "77", IsVIP: true, IsBroadcaster: true},
+		}},
+		{"set badges", []string{"/mod on", "/mod on", "!ping", "/mod off", "/vip on", "!ping"}, []types.Chatter{
+			{Name: "alice", ID: "77", IsMod: true},
+			{Name: "alice", ID: "77", IsVIP: true},
+		}},
+		// invalid directives are reported and don't change the chatter or reach the bot
+		{"invalid", []string{"/mod maybe", "/user", "/unknown", "!ping"}, []types.Chatter{
+			{Name: "alice", ID: "77"},
+		}},
+		{"quit", []string{"!ping", "/quit", "!ping"}, []types.Chatter{
+			{Name: "alice", ID: "77"},
+		}},
+	}
+
+	for _, test := range tests {
+		messages, _ := runConsole(t, test.lines...)
+		if len(messages) != len(test.expected) {
+			t.Errorf("%s: expected %d messages, got %d", test.name, len(test.expected), len(messages))
+			continue
+		}
+		for i, message := range messages {
+			if message.Chatter != test.expected[i] {
+				t.Errorf("%s: expected message %d from %+v, got %+v", test.name, i, test.expected[i], message.Chatter)
+			}
+			if message.Channel != "channel" || message.RoomID != "1" || message.Message != strings.TrimSpace(message.Message) {
+				t.Errorf("%s: unexpected message %+v", test.name, message)
+			}
+		}
+	}
+}
+
+func TestConsoleOutput(t *testing.T) {
+	messages, out := runConsole(t, "/status", "/vip", "/mod maybe", "/user", "/unknown", "hello")
+	if len(messages) != 1 || messages[0].Message != "hello" || messages[0].ID != "console-1" {
+		t.Errorf("unexpected messages: %+v", messages)
+	}
+
+	for _, expected := range []string{
+		"chatter=alice id=77 mod=false vip=false broadcaster=false channel=channel room=1",
+		"chatter=alice id=77 mod=false vip=true broadcaster=false channel=channel room=1",
+		"error: expected 'on' or 'off', got 'maybe'",
+		"error: usage: /user <name> [id]",
+		"error: unknown directive '/unknown'",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected the output to contain %q, got:\n%s", expected, out)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package platform
+
+import (
+	"monkebot/types"
+	"time"
+)
+
+// ChatPlatform is the adapter between the bot and a chat backend.
+//
+// Implementations are responsible for converting incoming chat messages into
+// a types.Message, the DB and Cfg fields are filled in by the bot afterwards.
+// Callbacks must be registered before calling Connect.
+type ChatPlatform interface {
+	// Connect blocks until the connection is closed
+	Connect() error
+	Disconnect() error
+
+	Join(channels ...string)
+	Part(channels ...string)
+	Say(channel string, message string)
+	Reply(channel string, parentMessageID string, message string)
+	Latency() (time.Duration, error)
+	// IsModerator reports whether the bot has moderator privileges in the channel
+	IsModerator(channel string) bool
+
+	OnConnect(callback func())
+	OnMessage(callback func(message *types.Message))
+	OnSelfJoin(callback func(channel string))
+	OnSelfPart(callback func(channel string))
+}
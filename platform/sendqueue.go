@@ -0,0 +1,283 @@
+package platform
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// DropPolicy decides what happens to a message sent while the queue is full
+type DropPolicy int
+
+const (
+	// DropNewest discards the message being sent
+	DropNewest DropPolicy = iota
+	// DropOldest discards the oldest queued message to make room for the new one
+	DropOldest
+	// Block makes Say and Reply wait until there is room in the queue
+	Block
+)
+
+var ErrInvalidDropPolicy = errors.New("invalid drop policy")
+
+func ParseDropPolicy(s string) (DropPolicy, error) {
+	switch s {
+	case "drop-newest":
+		return DropNewest, nil
+	case "drop-oldest":
+		return DropOldest, nil
+	case "block":
+		return Block, nil
+	}
+	return 0, fmt.Errorf("%w: '%s', must be 'drop-newest', 'drop-oldest' or 'block'", ErrInvalidDropPolicy, s)
+}
+
+type RateLimits struct {
+	// Window is the period in which at most Messages(or ModMessages) can be sent
+	Window      time.Duration
+	Messages    int
+	ModMessages int
+	// ChannelInterval is the minimum time between messages in a channel where the bot isn't a moderator
+	ChannelInterval time.Duration
+}
+
+// https://dev.twitch.tv/docs/irc/#rate-limits
+var TwitchRateLimits = RateLimits{
+	Window:          30 * time.Second,
+	Messages:        20,
+	ModMessages:     100,
+	ChannelInterval: time.Second,
+}
+
+type SendQueueOptions struct {
+	Size   int
+	Policy DropPolicy
+	Limits RateLimits
+}
+
+type outgoingMessage struct {
+	channel         string
+	parentMessageID string
+	message         string
+}
+
+// SendQueue is a ChatPlatform that queues messages sent with Say and Reply
+// and sends them through the wrapped platform respecting its rate limits.
+type SendQueue struct {
+	ChatPlatform
+
+	opts     SendQueueOptions
+	mu       sync.Mutex
+	hasSpace *sync.Cond
+	pending  []outgoingMessage
+	sending  int                  // messages taken from pending that the wrapped platform is still sending
+	sentAt   []time.Time          // send times inside the current window, oldest first
+	lastSent map[string]time.Time // last send time for each channel inside the channel interval
+	wake     chan struct{}
+	done     chan struct{}
+	closed   bool
+}
+
+func NewSendQueue(chat ChatPlatform, opts SendQueueOptions) *SendQueue {
+	q := &SendQueue{
+		ChatPlatform: chat,
+		opts:         opts,
+		lastSent:     make(map[string]time.Time),
+		wake:         make(chan struct{}, 1),
+		done:         make(chan struct{}),
+	}
+	q.hasSpace = sync.NewCond(&q.mu)
+
+	go q.run()
+	return q
+}
+
+func (q *SendQueue) Say(channel string, message string) {
+	q.enqueue(outgoingMessage{channel: channel, message: message})
+}
+
+func (q *SendQueue) Reply(channel string, parentMessageID string, message string) {
+	q.enqueue(outgoingMessage{channel: channel, parentMessageID: parentMessageID, message: message})
+}
+
+// Disconnect stops sending queued messages and disconnects the wrapped platform
+func (q *SendQueue) Disconnect() error {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.done)
+		q.hasSpace.Broadcast()
+	}
+	q.mu.Unlock()
+
+	return q.ChatPlatform.Disconnect()
+}
+
+// Flush waits until all queued messages are sent, including the one being sent, or ctx is done
+func (q *SendQueue) Flush(ctx context.Context) error {
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		q.mu.Lock()
+		depth := len(q.pending) + q.sending
+		q.mu.Unlock()
+		if depth == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Warn().Int("queueDepth", depth).Msg("gave up flushing send queue")
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Len returns the number of messages waiting to be sent
+func (q *SendQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending)
+}
+
+func (q *SendQueue) enqueue(msg outgoingMessage) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for !q.closed && len(q.pending) >= q.opts.Size {
+		switch q.opts.Policy {
+		case DropNewest:
+			log.Warn().Str("channel", msg.channel).Str("msg", msg.message).Int("queueDepth", len(q.pending)).Msg("send queue full, dropped new message")
+			return
+		case DropOldest:
+			dropped := q.pending[0]
+			q.pending = q.pending[1:]
+			log.Warn().Str("channel", dropped.channel).Str("msg", dropped.message).Int("queueDepth", len(q.pending)).Msg("send queue full, dropped oldest message")
+		case Block:
+			log.Warn().Str("channel", msg.channel).Int("queueDepth", len(q.pending)).Msg("send queue full, waiting for space")
+			q.hasSpace.Wait()
+		}
+	}
+
+	if q.closed {
+		log.Warn().Str("channel", msg.channel).Str("msg", msg.message).Msg("send queue closed, dropped message")
+		return
+	}
+
+	q.pending = append(q.pending, msg)
+	log.Debug().Str("channel", msg.channel).Int("queueDepth", len(q.pending)).Msg("queued message")
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (q *SendQueue) run() {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		q.mu.Lock()
+		msg, wait, ok := q.next(time.Now())
+		depth := len(q.pending)
+		q.mu.Unlock()
+
+		if ok {
+			if msg.parentMessageID != "" {
+				q.ChatPlatform.Reply(msg.channel, msg.parentMessageID, msg.message)
+			} else {
+				q.ChatPlatform.Say(msg.channel, msg.message)
+			}
+			log.Debug().Str("channel", msg.channel).Int("queueDepth", depth).Msg("sent queued message")
+
+			q.mu.Lock()
+			q.sending--
+			q.mu.Unlock()
+			continue
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		// nothing queued, sleep until a message is queued
+		if wait == 0 {
+			wait = time.Hour
+		}
+		timer.Reset(wait)
+
+		select {
+		case <-q.wake:
+		case <-timer.C:
+		case <-q.done:
+			return
+		}
+	}
+}
+
+// Removes and returns the first message allowed to be sent at now.
+// If no message can be sent, returns how long to wait until one might be, or 0 if the queue is empty.
+// Must be called with q.mu held.
+func (q *SendQueue) next(now time.Time) (msg outgoingMessage, wait time.Duration, ok bool) {
+	windowStart := now.Add(-q.opts.Limits.Window)
+	expired := 0
+	for expired < len(q.sentAt) && !q.sentAt[expired].After(windowStart) {
+		expired++
+	}
+	q.sentAt = q.sentAt[expired:]
+
+	// channels last sent to before the interval don't need to wait, so they're forgotten instead of kept forever
+	for channel, last := range q.lastSent {
+		if !last.Add(q.opts.Limits.ChannelInterval).After(now) {
+			delete(q.lastSent, channel)
+		}
+	}
+
+	// channels with a blocked message are skipped to keep messages ordered within a channel
+	blocked := make(map[string]bool)
+	for i, m := range q.pending {
+		if blocked[m.channel] {
+			continue
+		}
+
+		isMod := q.ChatPlatform.IsModerator(m.channel)
+		limit := q.opts.Limits.Messages
+		if isMod {
+			limit = q.opts.Limits.ModMessages
+		}
+
+		var msgWait time.Duration
+		if len(q.sentAt) >= limit {
+			msgWait = q.sentAt[len(q.sentAt)-limit].Add(q.opts.Limits.Window).Sub(now)
+		}
+		if last, found := q.lastSent[m.channel]; found && !isMod {
+			msgWait = max(msgWait, last.Add(q.opts.Limits.ChannelInterval).Sub(now))
+		}
+
+		if msgWait > 0 {
+			blocked[m.channel] = true
+			if wait == 0 || msgWait < wait {
+				wait = msgWait
+			}
+			continue
+		}
+
+		q.pending = append(q.pending[:i:i], q.pending[i+1:]...)
+		q.sentAt = append(q.sentAt, now)
+		q.lastSent[m.channel] = now
+		q.sending++
+		q.hasSpace.Signal()
+		return m, 0, true
+	}
+
+	return outgoingMessage{}, wait, false
+}
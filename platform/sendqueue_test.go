@@ -0,0 +1,276 @@
+package platform
+
+import (
+	"context"
+	"monkebot/types"
+	"sync"
+	"testing"
+	"time"
+)
+
+// implementation of ChatPlatform for testing that records sent messages
+type recordingPlatform struct {
+	mu        sync.Mutex
+	sent      []string
+	sentAt    []time.Time
+	modInChan map[string]bool
+	// how long Say takes, like a slow connection
+	sayDelay time.Duration
+}
+
+func (r *recordingPlatform) Connect() error          { return nil }
+func (r *recordingPlatform) Disconnect() error       { return nil }
+func (r *recordingPlatform) Join(channels ...string) {}
+func (r *recordingPlatform) Part(channels ...string) {}
+func (r *recordingPlatform) Say(channel string, message string) {
+	time.Sleep(r.sayDelay)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sent = append(r.sent, message)
+	r.sentAt = append(r.sentAt, time.Now())
+}
+
+func (r *recordingPlatform) Reply(channel string, parentMessageID string, message string) {
+	r.Say(channel, message)
+}
+func (r *recordingPlatform) Latency() (time.Duration, error)                 { return 0, nil }
+func (r *recordingPlatform) IsModerator(channel string) bool                 { return r.modInChan[channel] }
+func (r *recordingPlatform) OnConnect(callback func())                       {}
+func (r *recordingPlatform) OnMessage(callback func(message *types.Message)) {}
+func (r *recordingPlatform) OnSelfJoin(callback func(channel string))        {}
+func (r *recordingPlatform) OnSelfPart(callback func(channel string))        {}
+
+func (r *recordingPlatform) waitForMessages(t *testing.T, n int, timeout time.Duration) []string {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		r.mu.Lock()
+		if len(r.sent) >= n {
+			sent := append([]string{}, r.sent...)
+			r.mu.Unlock()
+			return sent
+		}
+		r.mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %d messages", n)
+	return nil
+}
+
+func TestSendQueueRateLimit(t *testing.T) {
+	chat := &recordingPlatform{}
+	q := NewSendQueue(chat, SendQueueOptions{
+		Size:   10,
+		Policy: DropNewest,
+		Limits: RateLimits{Window: 200 * time.Millisecond, Messages: 2, ModMessages: 4},
+	})
+	defer q.Disconnect()
+
+	start := time.Now()
+	q.Say("a", "1")
+	q.Say("b", "2")
+	q.Say("c", "3")
+
+	sent := chat.waitForMessages(t, 3, time.Second)
+	if sent[0] != "1" || sent[1] != "2" || sent[2] != "3" {
+		t.Errorf("unexpected message order: %v", sent)
+	}
+	if elapsed := chat.sentAt[2].Sub(start); elapsed < 200*time.Millisecond {
+		t.Errorf("third message was sent before the window expired: %s", elapsed)
+	}
+}
+
+func TestSendQueueModLimit(t *testing.T) {
+	chat := &recordingPlatform{modInChan: map[string]bool{"mod": true}}
+	q := NewSendQueue(chat, SendQueueOptions{
+		Size:   10,
+		Policy: DropNewest,
+		Limits: RateLimits{Window: time.Minute, Messages: 1, ModMessages: 3},
+	})
+	defer q.Disconnect()
+
+	q.Say("mod", "1")
+	q.Say("notmod", "2")
+	q.Say("mod", "3")
+
+	sent := chat.waitForMessages(t, 2, time.Second)
+	if sent[0] != "1" || sent[1] != "3" {
+		t.Errorf("expected only messages in the moderated channel to be sent, got %v", sent)
+	}
+	if q.Len() != 1 {
+		t.Errorf("expected 1 queued message, got %d", q.Len())
+	}
+}
+
+func TestSendQueueChannelInterval(t *testing.T) {
+	chat := &recordingPlatform{}
+	q := NewSendQueue(chat, SendQueueOptions{
+		Size:   10,
+		Policy: DropNewest,
+		Limits: RateLimits{Window: time.Minute, Messages: 10, ModMessages: 10, ChannelInterval: 100 * time.Millisecond},
+	})
+	defer q.Disconnect()
+
+	q.Say("a", "1")
+	q.Say("a", "2")
+	q.Say("b", "3")
+
+	sent := chat.waitForMessages(t, 3, time.Second)
+	if sent[0] != "1" || sent[1] != "3" || sent[2] != "2" {
+		t.Errorf("expected the message in another channel to skip the channel interval, got %v", sent)
+	}
+}
+
+func TestSendQueueDropPolicy(t *testing.T) {
+	tests := []struct {
+		policy   DropPolicy
+		expected []string
+	}{
+		{DropNewest, []string{"1", "2"}},
+		{DropOldest, []string{"1", "3"}},
+	}
+
+	for _, test := range tests {
+		chat := &recordingPlatform{}
+		q := NewSendQueue(chat, SendQueueOptions{
+			Size:   1,
+			Policy: test.policy,
+			Limits: RateLimits{Window: 100 * time.Millisecond, Messages: 1, ModMessages: 1},
+		})
+
+		q.Say("a", "1")
+		chat.waitForMessages(t, 1, time.Second)
+		q.Say("a", "2")
+		q.Say("a", "3")
+
+		sent := chat.waitForMessages(t, 2, time.Second)
+		time.Sleep(150 * time.Millisecond)
+		if len(chat.sent) != 2 || sent[0] != test.expected[0] || sent[1] != test.expected[1] {
+			t.Errorf("policy %d: expected %v, got %v", test.policy, test.expected, chat.sent)
+		}
+		q.Disconnect()
+	}
+}
+
+func TestSendQueueBlockPolicy(t *testing.T) {
+	chat := &recordingPlatform{}
+	q := NewSendQueue(chat, SendQueueOptions{
+		Size:   1,
+		Policy: Block,
+		Limits: RateLimits{Window: 100 * time.Millisecond, Messages: 1, ModMessages: 1},
+	})
+	defer q.Disconnect()
+
+	q.Say("a", "1")
+	chat.waitForMessages(t, 1, time.Second)
+	q.Say("a", "2")
+
+	returned := make(chan struct{})
+	go func() {
+		q.Say("a", "3")
+		close(returned)
+	}()
+
+	// 2 fills the queue until the rate limit lets it be sent
+	select {
+	case <-returned:
+		t.Fatal("expected Say to wait for space in the queue")
+	case <-time.After(30 * time.Millisecond):
+	}
+
+	sent := chat.waitForMessages(t, 3, time.Second)
+	<-returned
+	if sent[0] != "1" || sent[1] != "2" || sent[2] != "3" {
+		t.Errorf("expected no messages to be dropped, got %v", sent)
+	}
+}
+
+func TestSendQueueForgetsChannels(t *testing.T) {
+	chat := &recordingPlatform{}
+	q := NewSendQueue(chat, SendQueueOptions{
+		Size:   10,
+		Policy: DropNewest,
+		Limits: RateLimits{Window: time.Minute, Messages: 10, ModMessages: 10, ChannelInterval: 10 * time.Millisecond},
+	})
+	defer q.Disconnect()
+
+	q.Say("a", "1")
+	q.Say("b", "2")
+	chat.waitForMessages(t, 2, time.Second)
+	time.Sleep(20 * time.Millisecond)
+	q.Say("c", "3")
+	chat.waitForMessages(t, 3, time.Second)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, ok := q.lastSent["c"]; len(q.lastSent) != 1 || !ok {
+		t.Errorf("expected only the channel inside the interval to be kept, got %v", q.lastSent)
+	}
+}
+
+func TestParseDropPolicy(t *testing.T) {
+	policy, err := ParseDropPolicy("block")
+	if err != nil || policy != Block {
+		t.Errorf("failed to parse 'block': %v", err)
+	}
+
+	_, err = ParseDropPolicy("invalid")
+	if err == nil {
+		t.Errorf("expected error for invalid policy")
+	}
+}
+
+func TestSendQueueFlush(t *testing.T) {
+	chat := &recordingPlatform{}
+	q := NewSendQueue(chat, SendQueueOptions{
+		Size:   10,
+		Policy: DropNewest,
+		Limits: RateLimits{Window: 100 * time.Millisecond, Messages: 1, ModMessages: 1},
+	})
+	defer q.Disconnect()
+
+	q.Say("a", "1")
+	q.Say("a", "2")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := q.Flush(ctx); err != nil {
+		t.Fatalf("failed to flush: %v", err)
+	}
+	if q.Len() != 0 {
+		t.Errorf("expected empty queue after flush, got %d", q.Len())
+	}
+
+	q.Say("a", "3")
+	q.Say("a", "4")
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := q.Flush(ctx); err == nil {
+		t.Errorf("expected flush to time out")
+	}
+}
+
+func TestSendQueueFlushWaitsForSending(t *testing.T) {
+	chat := &recordingPlatform{sayDelay: 100 * time.Millisecond}
+	q := NewSendQueue(chat, SendQueueOptions{
+		Size:   10,
+		Policy: DropNewest,
+		Limits: RateLimits{Window: 100 * time.Millisecond, Messages: 1, ModMessages: 1},
+	})
+	defer q.Disconnect()
+
+	// the rate limiter delays the last message, which is taken from the queue while still being sent
+	q.Say("a", "1")
+	q.Say("a", "2")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := q.Flush(ctx); err != nil {
+		t.Fatalf("failed to flush: %v", err)
+	}
+
+	chat.mu.Lock()
+	defer chat.mu.Unlock()
+	if len(chat.sent) != 2 {
+		t.Errorf("expected both messages to be sent when flush returns, got %v", chat.sent)
+	}
+}
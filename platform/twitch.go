@@ -0,0 +1,116 @@
+package platform
+
+import (
+	"monkebot/types"
+	"sync"
+	"time"
+
+	"github.com/gempir/go-twitch-irc/v4"
+)
+
+// Twitch is a ChatPlatform backed by Twitch IRC
+type Twitch struct {
+	client *twitch.Client
+
+	// channels where the bot is a moderator or broadcaster, updated from USERSTATE messages
+	modChannels   map[string]bool
+	modChannelsMu sync.RWMutex
+}
+
+func NewTwitch(login string, token string) *Twitch {
+	t := &Twitch{
+		client:      twitch.NewClient(login, "oauth:"+token),
+		modChannels: make(map[string]bool),
+	}
+
+	t.client.OnUserStateMessage(func(message twitch.UserStateMessage) {
+		_, isMod := message.User.Badges["moderator"]
+		_, isBroadcaster := message.User.Badges["broadcaster"]
+
+		t.modChannelsMu.Lock()
+		t.modChannels[message.Channel] = isMod || isBroadcaster
+		t.modChannelsMu.Unlock()
+	})
+
+	return t
+}
+
+func newMessage(msg twitch.PrivateMessage) *types.Message {
+	return &types.Message{
+		ID:      msg.ID,
+		Message: msg.Message,
+		Time:    msg.Time,
+		Channel: msg.Channel,
+		RoomID:  msg.RoomID,
+		Chatter: types.Chatter{
+			Name:          msg.User.Name,
+			ID:            msg.User.ID,
+			IsMod:         msg.User.IsMod,
+			IsVIP:         msg.User.IsVip,
+			IsBroadcaster: msg.User.IsBroadcaster,
+		},
+	}
+}
+
+// SetToken updates the token used when connecting, so reconnects use a refreshed token
+func (t *Twitch) SetToken(token string) {
+	t.client.SetIRCToken("oauth:" + token)
+}
+
+func (t *Twitch) Connect() error {
+	return t.client.Connect()
+}
+
+func (t *Twitch) Disconnect() error {
+	return t.client.Disconnect()
+}
+
+func (t *Twitch) Join(channels ...string) {
+	t.client.Join(channels...)
+}
+
+func (t *Twitch) Part(channels ...string) {
+	for _, channel := range channels {
+		t.client.Depart(channel)
+	}
+}
+
+func (t *Twitch) Say(channel string, message string) {
+	t.client.Say(channel, message)
+}
+
+func (t *Twitch) Reply(channel string, parentMessageID string, message string) {
+	t.client.Reply(channel, parentMessageID, message)
+}
+
+func (t *Twitch) Latency() (time.Duration, error) {
+	return t.client.Latency()
+}
+
+func (t *Twitch) IsModerator(channel string) bool {
+	t.modChannelsMu.RLock()
+	defer t.modChannelsMu.RUnlock()
+	return t.modChannels[channel]
+}
+
+func (t *Twitch) OnConnect(callback func()) {
+	t.client.OnConnect(callback)
+}
+
+func (t *Twitch) OnMessage(callback func(message *types.Message)) {
+	t.client.OnPrivateMessage(func(message twitch.PrivateMessage) {
+		callback(newMessage(message))
+	})
+}
+
+func (t *Twitch) OnSelfJoin(callback func(channel string)) {
+	t.client.OnSelfJoinMessage(func(message twitch.UserJoinMessage) {
+		callback(message.Channel)
+	})
+}
+
+func (t *Twitch) OnSelfPart(callback func(channel string)) {
+	t.client.OnSelfPartMessage(func(message twitch.UserPartMessage) {
+		callback(message.Channel)
+	})
+}
@@ -0,0 +1,233 @@
+// Package template fills in the variables of command responses, like "${user} has ${balance} buttinho".
+// Variables are written as ${name} or ${name param...}, values aren't parsed again, so args can't add variables.
+package template
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"monkebot/database"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// MaxLength is the most characters a response can have once filled in, longer ones are cut
+const MaxLength = 400
+
+// Data is what the variables are filled in with
+type Data struct {
+	// used by ${count} and ${balance}
+	Tx        *sql.Tx
+	ChannelID string
+	Channel   string
+	UserID    string
+	User      string
+	// the command the response belongs to, ${count} counts its uses in the channel
+	Command string
+	// args after the command name, ${args.1} is the first one
+	Args   []string
+	Uptime time.Duration
+}
+
+// Template is a parsed response, ready to be executed many times
+type Template struct {
+	parts []part
+}
+
+// literal text, or a variable if name isn't empty
+type part struct {
+	text   string
+	name   string
+	params []string
+}
+
+type variable struct {
+	// checks the params when parsing, nil for variables without params
+	check func(params []string) error
+	value func(data *Data, params []string, state *execState) (string, error)
+}
+
+// values that must be the same everywhere in a response
+type execState struct {
+	count *int
+}
+
+var variables = map[string]variable{
+	"user": {value: func(data *Data, _ []string, _ *execState) (string, error) {
+		return data.User, nil
+	}},
+	"channel": {value: func(data *Data, _ []string, _ *execState) (string, error) {
+		return data.Channel, nil
+	}},
+	"uptime": {value: func(data *Data, _ []string, _ *execState) (string, error) {
+		return data.Uptime.Round(time.Second).String(), nil
+	}},
+	"random": {check: checkRandom, value: random},
+	"count": {value: func(data *Data, _ []string, state *execState) (string, error) {
+		// the counter goes up once per response, no matter how many times it's shown
+		if state.count == nil {
+			count, err := database.IncrementCommandCounter(data.Tx, data.ChannelID, data.Command)
+			if err != nil {
+				return "", err
+			}
+			state.count = &count
+		}
+		return strconv.Itoa(*state.count), nil
+	}},
+	"balance": {value: func(data *Data, _ []string, _ *execState) (string, error) {
+		amount, err := database.SelectUserItemAmount(data.Tx, data.UserID, "buttinho")
+		if err != nil {
+			return "", err
+		}
+		return strconv.Itoa(amount), nil
+	}},
+}
+
+// Parse returns an error meant for users if text has an unclosed or unknown variable, or invalid params
+func Parse(text string) (*Template, error) {
+	t := &Template{}
+	for {
+		start := strings.Index(text, "${")
+		if start == -1 {
+			break
+		}
+		if start > 0 {
+			t.parts = append(t.parts, part{text: text[:start]})
+		}
+
+		end := strings.IndexByte(text[start:], '}')
+		if end == -1 {
+			return nil, fmt.Errorf("missing } after %s", text[start:])
+		}
+		fields := strings.Fields(text[start+2 : start+end])
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("empty variable ${}")
+		}
+
+		p := part{name: fields[0], params: fields[1:]}
+		err := checkVariable(p)
+		if err != nil {
+			return nil, err
+		}
+		t.parts = append(t.parts, p)
+		text = text[start+end+1:]
+	}
+	if text != "" {
+		t.parts = append(t.parts, part{text: text})
+	}
+	return t, nil
+}
+
+func checkVariable(p part) error {
+	if index, ok := strings.CutPrefix(p.name, "args."); ok {
+		n, err := strconv.Atoi(index)
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid variable ${%s}, args start at ${args.1}", p.name)
+		}
+		if len(p.params) > 0 {
+			return fmt.Errorf("${%s} doesn't take params", p.name)
+		}
+		return nil
+	}
+
+	v, ok := variables[p.name]
+	if !ok {
+		return fmt.Errorf("unknown variable ${%s}", p.name)
+	}
+	if v.check == nil {
+		if len(p.params) > 0 {
+			return fmt.Errorf("${%s} doesn't take params", p.name)
+		}
+		return nil
+	}
+	return v.check(p.params)
+}
+
+// Execute fills in the variables with data, cutting the response at MaxLength characters
+func (t *Template) Execute(data *Data) (string, error) {
+	var (
+		result strings.Builder
+		state  execState
+	)
+	for _, p := range t.parts {
+		if result.Len() > MaxLength*utf8.UTFMax {
+			break
+		}
+		if p.name == "" {
+			result.WriteString(p.text)
+			continue
+		}
+
+		value, err := executeVariable(data, p, &state)
+		if err != nil {
+			return "", fmt.Errorf("failed to fill in ${%s}: %w", p.name, err)
+		}
+		result.WriteString(value)
+	}
+	return truncate(result.String(), MaxLength), nil
+}
+
+func executeVariable(data *Data, p part, state *execState) (string, error) {
+	if index, ok := strings.CutPrefix(p.name, "args."); ok {
+		// checked by Parse
+		n, _ := strconv.Atoi(index)
+		if n > len(data.Args) {
+			return "", nil
+		}
+		return data.Args[n-1], nil
+	}
+	return variables[p.name].value(data, p.params, state)
+}
+
+// Render parses and executes text
+func Render(text string, data *Data) (string, error) {
+	t, err := Parse(text)
+	if err != nil {
+		return "", err
+	}
+	return t.Execute(data)
+}
+
+// Cuts s to maxLength characters, ending with … if it was cut
+func truncate(s string, maxLength int) string {
+	if utf8.RuneCountInString(s) <= maxLength {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:maxLength-1]) + "…"
+}
+
+func checkRandom(params []string) error {
+	if len(params) != 2 {
+		return fmt.Errorf("${random} needs a min and a max, like ${random 1 100}")
+	}
+	low, errLow := strconv.ParseInt(params[0], 10, 64)
+	high, errHigh := strconv.ParseInt(params[1], 10, 64)
+	if errLow != nil || errHigh != nil {
+		return fmt.Errorf("${random} needs whole numbers, like ${random 1 100}")
+	}
+	if low > high {
+		return fmt.Errorf("the min of ${random} must not be bigger than the max")
+	}
+	return nil
+}
+
+// Returns a number between the params, including both
+func random(_ *Data, params []string, _ *execState) (string, error) {
+	// checked by Parse
+	low, _ := strconv.ParseInt(params[0], 10, 64)
+	high, _ := strconv.ParseInt(params[1], 10, 64)
+
+	// unsigned, so the size of the range doesn't overflow
+	span := uint64(high - low)
+	var n uint64
+	if span == math.MaxUint64 {
+		n = rand.Uint64()
+	} else {
+		n = rand.Uint64N(span + 1)
+	}
+	return strconv.FormatInt(low+int64(n), 10), nil
+}
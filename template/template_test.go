@@ -0,0 +1,145 @@
+package template
+
+import (
+	"database/sql"
+	"monkebot/database"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func newTestDB(t *testing.T) *sql.DB {
+	db, err := database.InitDB("sqlite3", "file:"+filepath.Join(t.TempDir(), "test.db"), 0)
+	if err != nil {
+		t.Fatalf("failed to init database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestRender(t *testing.T) {
+	data := &Data{
+		Channel: "channel",
+		User:    "alice",
+		Args:    []string{"bob", "${user}"},
+		Uptime:  90*time.Minute + 500*time.Millisecond,
+	}
+	tests := []struct {
+		text, expected string
+	}{
+		{"no variables", "no variables"},
+		{"${user} hugs ${args.1}", "alice hugs bob"},
+		{"${ channel }: ${args.3}!", "channel: !"},
+		// args aren't parsed again
+		{"${args.2}", "${user}"},
+		{"up for ${uptime}", "up for 1h30m1s"},
+		{"$5 {not a variable}", "$5 {not a variable}"},
+		{"${random 7 7}", "7"},
+	}
+	for _, test := range tests {
+		result, err := Render(test.text, data)
+		if err != nil {
+			t.Errorf("unexpected error rendering '%s': %v", test.text, err)
+			continue
+		}
+		if result != test.expected {
+			t.Errorf("expected '%s' to render '%s', got '%s'", test.text, test.expected, result)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, text := range []string{
+		"${user",
+		"${}",
+		"${unknown}",
+		"${args.0}",
+		"${args.x}",
+		"${user 1}",
+		"${random 1}",
+		"${random a b}",
+		"${random 10 1}",
+	} {
+		_, err := Parse(text)
+		if err == nil {
+			t.Errorf("expected an error parsing '%s'", text)
+		}
+	}
+}
+
+func TestRandom(t *testing.T) {
+	for _, text := range []string{"${random 1 3}", "${random -9223372036854775808 9223372036854775807}"} {
+		tmpl, err := Parse(text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 100; i++ {
+			result, err := tmpl.Execute(&Data{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			n, err := strconv.ParseInt(result, 10, 64)
+			if err != nil {
+				t.Fatalf("expected a number, got '%s'", result)
+			}
+			if text == "${random 1 3}" && (n < 1 || n > 3) {
+				t.Fatalf("expected a number from 1 to 3, got %d", n)
+			}
+		}
+	}
+}
+
+func TestMaxLength(t *testing.T) {
+	result, err := Render(strings.Repeat("${args.1}", 10), &Data{Args: []string{strings.Repeat("🐒", 100)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if utf8.RuneCountInString(result) != MaxLength || !strings.HasSuffix(result, "…") {
+		t.Errorf("expected the response to be cut at %d characters, got %d", MaxLength, utf8.RuneCountInString(result))
+	}
+}
+
+func TestCountAndBalance(t *testing.T) {
+	db := newTestDB(t)
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	err = database.InsertUsers(tx, true, struct{ ID, Name string }{"1", "channel"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tx.Exec("INSERT INTO rpg_user_item (user_id, rpg_item_id, amount) SELECT '1', id, 42 FROM rpg_item WHERE name = 'buttinho'")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl, err := Parse("#${count} (${count}) ${balance}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := &Data{Tx: tx, ChannelID: "1", UserID: "1", Command: "deaths"}
+	for _, expected := range []string{"#1 (1) 42", "#2 (2) 42"} {
+		result, err := tmpl.Execute(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result != expected {
+			t.Errorf("expected '%s', got '%s'", expected, result)
+		}
+	}
+
+	// counters are per command, and users without buttinhos have none
+	result, err := Render("${count} ${balance}", &Data{Tx: tx, ChannelID: "1", UserID: "2", Command: "wins"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != "1 0" {
+		t.Errorf("expected '1 0', got '%s'", result)
+	}
+}
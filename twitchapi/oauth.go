@@ -0,0 +1,185 @@
+package twitchapi
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"monkebot/config"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// TokenSource provides the current access token for Helix requests
+type TokenSource interface {
+	AccessToken() string
+}
+
+// TokenStore persists tokens, so that a rotated refresh token survives restarts.
+// configRefreshToken is the refresh token that was in the config when the token was saved, empty if unknown.
+// LoadToken returns sql.ErrNoRows if no token was saved yet.
+type TokenStore interface {
+	LoadToken() (accessToken string, refreshToken string, configRefreshToken string, expiresAt time.Time, err error)
+	SaveToken(accessToken string, refreshToken string, configRefreshToken string, expiresAt time.Time) error
+}
+
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+// TokenManager refreshes the bot's OAuth token before it expires
+type TokenManager struct {
+	// TokenURL is the endpoint used to refresh tokens, replaced in tests
+	TokenURL string
+	// RefreshMargin is how long before expiry the token is refreshed
+	RefreshMargin time.Duration
+
+	clientID     string
+	clientSecret string
+	store        TokenStore
+	httpClient   *http.Client
+
+	// saved with the token, so a refresh token changed in the config replaces the saved one
+	configRefreshToken string
+
+	mu           sync.RWMutex
+	accessToken  string
+	refreshToken string
+	expiresAt    time.Time
+	onRefresh    []func(accessToken string)
+}
+
+// NewTokenManager creates a token manager using the refresh token saved in store, falling back to the one in the
+// config if none was saved yet. A refresh token changed in the config since it was saved, like after revoking the old
+// one, replaces the saved one.
+func NewTokenManager(cfg config.Config, store TokenStore) (*TokenManager, error) {
+	m := &TokenManager{
+		TokenURL:           "https://id.twitch.tv/oauth2/token",
+		RefreshMargin:      10 * time.Minute,
+		clientID:           cfg.ClientID,
+		clientSecret:       cfg.ClientSecret,
+		store:              store,
+		httpClient:         http.DefaultClient,
+		configRefreshToken: cfg.RefreshToken,
+		accessToken:        cfg.TwitchToken,
+		refreshToken:       cfg.RefreshToken,
+	}
+
+	accessToken, refreshToken, configRefreshToken, expiresAt, err := store.LoadToken()
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		log.Info().Msg("no saved token, using refresh token from config")
+	case err != nil:
+		return nil, fmt.Errorf("failed to load saved token: %w", err)
+	case configRefreshToken != "" && cfg.RefreshToken != configRefreshToken:
+		log.Info().Msg("refresh token in the config changed since the token was saved, using it instead of the saved one")
+	default:
+		// tokens saved before the config's refresh token was saved with them can't tell if it changed
+		if configRefreshToken == "" && cfg.RefreshToken != refreshToken {
+			log.Warn().Msg("the saved refresh token overrides the one in the config")
+		}
+		m.accessToken, m.refreshToken, m.expiresAt = accessToken, refreshToken, expiresAt
+	}
+
+	return m, nil
+}
+
+func (m *TokenManager) AccessToken() string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.accessToken
+}
+
+func (m *TokenManager) ExpiresAt() time.Time {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.expiresAt
+}
+
+// OnRefresh registers a callback called with the new access token after every refresh
+func (m *TokenManager) OnRefresh(callback func(accessToken string)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onRefresh = append(m.onRefresh, callback)
+}
+
+// Refresh gets a new access token, rotating the refresh token if Twitch returns a new one, and saves them
+func (m *TokenManager) Refresh() error {
+	m.mu.RLock()
+	refreshToken := m.refreshToken
+	m.mu.RUnlock()
+
+	resp, err := m.httpClient.PostForm(m.TokenURL, url.Values{
+		"client_id":     {m.clientID},
+		"client_secret": {m.clientSecret},
+		"refresh_token": {refreshToken},
+		"grant_type":    {"refresh_token"},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to fetch oauth token from twitch client secret: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to refresh token. Status: %s", resp.Status)
+	}
+
+	var token tokenResponse
+	err = json.NewDecoder(resp.Body).Decode(&token)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal oauth token response: %w", err)
+	}
+	if token.AccessToken == "" {
+		return fmt.Errorf("oauth token response has no access token")
+	}
+
+	m.mu.Lock()
+	m.accessToken = token.AccessToken
+	if token.RefreshToken != "" && token.RefreshToken != m.refreshToken {
+		log.Info().Msg("twitch rotated the refresh token")
+		m.refreshToken = token.RefreshToken
+	}
+	m.expiresAt = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	accessToken, refreshToken, expiresAt := m.accessToken, m.refreshToken, m.expiresAt
+	callbacks := m.onRefresh
+	m.mu.Unlock()
+
+	err = m.store.SaveToken(accessToken, refreshToken, m.configRefreshToken, expiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to save refreshed token: %w", err)
+	}
+
+	log.Info().Time("expiresAt", expiresAt).Msg("refreshed twitch token")
+	for _, callback := range callbacks {
+		callback(accessToken)
+	}
+
+	return nil
+}
+
+// Run refreshes the token before it expires until ctx is done
+func (m *TokenManager) Run(ctx context.Context) {
+	// minimum time between refreshes, so failures or short lived tokens don't cause a busy loop
+	const minInterval = time.Minute
+
+	for {
+		wait := max(minInterval, time.Until(m.ExpiresAt().Add(-m.RefreshMargin)))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+
+		err := m.Refresh()
+		if err != nil {
+			log.Err(err).Msg("failed to refresh twitch token")
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package twitchapi
+
+import (
+	"database/sql"
+	"fmt"
+	"monkebot/config"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// implementation of TokenStore for testing
+type memoryTokenStore struct {
+	accessToken        string
+	refreshToken       string
+	configRefreshToken string
+	expiresAt          time.Time
+	saved              bool
+}
+
+func (s *memoryTokenStore) LoadToken() (string, string, string, time.Time, error) {
+	if !s.saved {
+		return "", "", "", time.Time{}, sql.ErrNoRows
+	}
+	return s.accessToken, s.refreshToken, s.configRefreshToken, s.expiresAt, nil
+}
+
+func (s *memoryTokenStore) SaveToken(accessToken string, refreshToken string, configRefreshToken string, expiresAt time.Time) error {
+	s.accessToken, s.refreshToken, s.configRefreshToken, s.expiresAt = accessToken, refreshToken, configRefreshToken, expiresAt
+	s.saved = true
+	return nil
+}
+
+func TestTokenManagerRefresh(t *testing.T) {
+	var receivedRefreshTokens []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receivedRefreshTokens = append(receivedRefreshTokens, r.FormValue("refresh_token"))
+		n := len(receivedRefreshTokens)
+		fmt.Fprintf(w, `{"access_token": "access%d", "refresh_token": "refresh%d", "expires_in": 3600}`, n, n)
+	}))
+	defer server.Close()
+
+	store := &memoryTokenStore{}
+	m, err := NewTokenManager(config.Config{TwitchToken: "initial", RefreshToken: "refresh0"}, store)
+	if err != nil {
+		t.Fatalf("failed to create token manager: %v", err)
+	}
+	m.TokenURL = server.URL
+
+	if m.AccessToken() != "initial" {
+		t.Errorf("expected the token in the config before the first refresh, got %s", m.AccessToken())
+	}
+
+	var refreshedTokens []string
+	m.OnRefresh(func(accessToken string) {
+		refreshedTokens = append(refreshedTokens, accessToken)
+	})
+
+	for range 2 {
+		if err = m.Refresh(); err != nil {
+			t.Fatalf("failed to refresh token: %v", err)
+		}
+	}
+
+	// the rotated refresh token must be used in the next refresh
+	if receivedRefreshTokens[0] != "refresh0" || receivedRefreshTokens[1] != "refresh1" {
+		t.Errorf("refresh token was not rotated: %v", receivedRefreshTokens)
+	}
+	if m.AccessToken() != "access2" {
+		t.Errorf("expected access2, got %s", m.AccessToken())
+	}
+	if len(refreshedTokens) != 2 || refreshedTokens[1] != "access2" {
+		t.Errorf("refresh callback not called with new tokens: %v", refreshedTokens)
+	}
+	if store.refreshToken != "refresh2" || store.accessToken != "access2" || store.configRefreshToken != "refresh0" {
+		t.Errorf("refreshed token was not saved: %+v", store)
+	}
+	if until := time.Until(m.ExpiresAt()); until < 59*time.Minute || until > time.Hour {
+		t.Errorf("unexpected expiry time: %s", until)
+	}
+
+	// a new manager uses the saved refresh token instead of the one in the config
+	m, err = NewTokenManager(config.Config{RefreshToken: "refresh0"}, store)
+	if err != nil {
+		t.Fatalf("failed to create token manager: %v", err)
+	}
+	m.TokenURL = server.URL
+	if err = m.Refresh(); err != nil {
+		t.Fatalf("failed to refresh token: %v", err)
+	}
+	if receivedRefreshTokens[2] != "refresh2" {
+		t.Errorf("expected saved refresh token to be used, got %s", receivedRefreshTokens[2])
+	}
+}
+
+func TestTokenManagerConfigChanged(t *testing.T) {
+	saved := memoryTokenStore{accessToken: "saved", refreshToken: "rotated", configRefreshToken: "old", expiresAt: time.Now().Add(time.Hour), saved: true}
+	tests := []struct {
+		configRefreshToken string
+		savedConfigToken   string
+		expected           string
+	}{
+		// twitch rotated the token since it was saved, the config still has the token it started with
+		{"old", "old", "rotated"},
+		// replaced in the config, like after revoking the old one
+		{"new", "old", "new"},
+		// saved before the config's token was, so it can't tell if it changed
+		{"new", "", "rotated"},
+	}
+	for _, test := range tests {
+		store := saved
+		store.configRefreshToken = test.savedConfigToken
+		m, err := NewTokenManager(config.Config{TwitchToken: "config", RefreshToken: test.configRefreshToken}, &store)
+		if err != nil {
+			t.Fatalf("failed to create token manager: %v", err)
+		}
+		if m.refreshToken != test.expected {
+			t.Errorf("config %s, saved with %s: expected refresh token %s, got %s", test.configRefreshToken, test.savedConfigToken, test.expected, m.refreshToken)
+		}
+	}
+}
+
+func TestTokenManagerRefreshError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	store := &memoryTokenStore{}
+	m, err := NewTokenManager(config.Config{TwitchToken: "initial", RefreshToken: "invalid"}, store)
+	if err != nil {
+		t.Fatalf("failed to create token manager: %v", err)
+	}
+	m.TokenURL = server.URL
+
+	if err = m.Refresh(); err == nil {
+		t.Fatalf("expected refresh to fail")
+	}
+	if m.AccessToken() != "initial" || store.saved {
+		t.Errorf("failed refresh changed the token")
+	}
+}
@@ -2,10 +2,11 @@ package twitchapi
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"monkebot/config"
 	"net/http"
-	"strings"
+	"net/url"
+	"strconv"
 	"time"
 
 	"github.com/rs/zerolog/log"
@@ -29,77 +30,158 @@ type helixUserResponse struct {
 	Data []HelixUser `json:"data"`
 }
 
-func GetUserByName(config *config.Config, names ...string) (*[]HelixUser, error) {
-	if len(names) == 0 {
-		return nil, nil
-	}
-	if len(names) > 100 {
-		return nil, fmt.Errorf("exceeded maximum number of names (100)")
-	}
-	var nameParams []string
-	for _, name := range names {
-		nameParams = append(nameParams, "login="+name)
-	}
-	requestURL := "https://api.twitch.tv/helix/users?" + strings.Join(nameParams, "&")
-	log.Debug().Str("request", requestURL).Strs("names", names).Msg("generated helix user request")
+type helixErrorResponse struct {
+	Message string `json:"message"`
+}
 
-	req, err := http.NewRequest("GET", requestURL, nil)
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Add("Authorization", "Bearer "+config.TwitchToken)
-	req.Header.Add("Client-Id", config.ClientID)
+var (
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrNotFound     = errors.New("not found")
+	ErrServer       = errors.New("helix server error")
+	ErrRateLimited  = errors.New("rate limited")
+)
 
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("failed to get user. Status: %s", resp.Status)
+// HelixError is returned for unsuccessful responses, use errors.Is with
+// ErrUnauthorized, ErrNotFound, ErrServer or ErrRateLimited to check the kind of error
+type HelixError struct {
+	StatusCode int
+	Status     string
+	Message    string
+}
+
+func (e *HelixError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("helix request failed. Status: %s", e.Status)
 	}
-	defer resp.Body.Close()
+	return fmt.Sprintf("helix request failed. Status: %s: %s", e.Status, e.Message)
+}
 
-	var response helixUserResponse
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return nil, err
+func (e *HelixError) Unwrap() error {
+	switch {
+	case e.StatusCode == http.StatusUnauthorized:
+		return ErrUnauthorized
+	case e.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case e.StatusCode == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case e.StatusCode >= 500:
+		return ErrServer
 	}
+	return nil
+}
+
+// StaticToken is a TokenSource that always returns the same token
+type StaticToken string
 
-	return &response.Data, nil
+func (t StaticToken) AccessToken() string {
+	return string(t)
 }
 
-func GetUserByID(config config.Config, ids ...string) (*[]HelixUser, error) {
-	if len(ids) == 0 {
-		return nil, nil
-	}
-	if len(ids) > 100 {
-		return nil, fmt.Errorf("exceeded maximum number of names (100)")
-	}
-	var idsParams []string
-	for _, id := range ids {
-		idsParams = append(idsParams, "id="+id)
-	}
-	requestURL := "https://api.twitch.tv/helix/users?" + strings.Join(idsParams, "&")
-	log.Debug().Str("request", requestURL).Strs("names", ids).Msg("generated helix user request")
-	req, err := http.NewRequest("GET", requestURL, nil)
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Add("Authorization", "Bearer "+config.TwitchToken)
-	req.Header.Add("Client-Id", config.ClientID)
+type httpClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
 
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, err
+// Helix allows at most this many ids or logins in a single users request
+const maxUsersPerRequest = 100
+
+// Client makes requests to the Helix API
+type Client struct {
+	// BaseURL is replaced with a fake Helix server in tests
+	BaseURL    string
+	HTTPClient httpClient
+	ClientID   string
+	Tokens     TokenSource
+	// MaxRetries is how many times a rate limited request is retried
+	MaxRetries int
+	// MaxRetryWait is the longest the client will wait for the rate limit to reset
+	MaxRetryWait time.Duration
+}
+
+func NewClient(clientID string, tokens TokenSource) *Client {
+	return &Client{
+		BaseURL:      "https://api.twitch.tv/helix",
+		HTTPClient:   http.DefaultClient,
+		ClientID:     clientID,
+		Tokens:       tokens,
+		MaxRetries:   3,
+		MaxRetryWait: time.Minute,
 	}
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("failed to get user. Status: %s", resp.Status)
+}
+
+// GetUsersByName gets users by login, users that don't exist are not included in the result
+func (c *Client) GetUsersByName(names ...string) ([]HelixUser, error) {
+	return c.getUsers("login", names)
+}
+
+// GetUsersByID gets users by id, users that don't exist are not included in the result
+func (c *Client) GetUsersByID(ids ...string) ([]HelixUser, error) {
+	return c.getUsers("id", ids)
+}
+
+// gets users in batches of maxUsersPerRequest
+func (c *Client) getUsers(param string, values []string) ([]HelixUser, error) {
+	users := make([]HelixUser, 0, len(values))
+	for start := 0; start < len(values); start += maxUsersPerRequest {
+		batch := values[start:min(start+maxUsersPerRequest, len(values))]
+
+		query := url.Values{param: batch}
+		var response helixUserResponse
+		err := c.get("/users", query, &response)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get users: %w", err)
+		}
+		users = append(users, response.Data...)
 	}
-	defer resp.Body.Close()
 
-	var response helixUserResponse
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return nil, err
+	return users, nil
+}
+
+// sends a GET request to path and decodes the JSON response into result, retrying if rate limited
+func (c *Client) get(path string, query url.Values, result any) error {
+	requestURL := c.BaseURL + path + "?" + query.Encode()
+
+	for attempt := 0; ; attempt++ {
+		log.Debug().Str("request", requestURL).Int("attempt", attempt).Msg("sending helix request")
+
+		req, err := http.NewRequest("GET", requestURL, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Add("Authorization", "Bearer "+c.Tokens.AccessToken())
+		req.Header.Add("Client-Id", c.ClientID)
+
+		resp, err := c.HTTPClient.Do(req)
+		if err != nil {
+			return err
+		}
+
+		if resp.StatusCode == http.StatusOK {
+			defer resp.Body.Close()
+			return json.NewDecoder(resp.Body).Decode(result)
+		}
+
+		helixErr := &HelixError{StatusCode: resp.StatusCode, Status: resp.Status}
+		var errResponse helixErrorResponse
+		if json.NewDecoder(resp.Body).Decode(&errResponse) == nil {
+			helixErr.Message = errResponse.Message
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusTooManyRequests || attempt >= c.MaxRetries {
+			return helixErr
+		}
+
+		wait := c.retryWait(resp.Header.Get("Ratelimit-Reset"))
+		log.Warn().Str("request", requestURL).Str("wait", wait.String()).Msg("helix rate limit reached, retrying")
+		time.Sleep(wait)
 	}
+}
 
-	return &response.Data, nil
+// returns how long to wait for the rate limit to reset, from the unix timestamp in the Ratelimit-Reset header
+func (c *Client) retryWait(reset string) time.Duration {
+	resetUnix, err := strconv.ParseInt(reset, 10, 64)
+	if err != nil {
+		return time.Second
+	}
+	return min(max(0, time.Until(time.Unix(resetUnix, 0))), c.MaxRetryWait)
 }
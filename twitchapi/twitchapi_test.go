@@ -0,0 +1,149 @@
+package twitchapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// fake Helix users endpoint that returns a user for every login or id requested
+func newFakeHelix(t *testing.T, handler func(w http.ResponseWriter, r *http.Request) bool) *Client {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if handler != nil && handler(w, r) {
+			return
+		}
+
+		var response helixUserResponse
+		for _, login := range r.URL.Query()["login"] {
+			response.Data = append(response.Data, HelixUser{ID: "id_" + login, Login: login})
+		}
+		for _, id := range r.URL.Query()["id"] {
+			response.Data = append(response.Data, HelixUser{ID: id, Login: "login_" + id})
+		}
+		json.NewEncoder(w).Encode(response)
+	}))
+	t.Cleanup(server.Close)
+
+	client := NewClient("clientid", StaticToken("token"))
+	client.BaseURL = server.URL
+	client.HTTPClient = server.Client()
+	return client
+}
+
+func TestGetUsersByName(t *testing.T) {
+	client := newFakeHelix(t, func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Path != "/users" {
+			t.Errorf("expected path /users, got %s", r.URL.Path)
+		}
+		if r.Header.Get("Authorization") != "Bearer token" || r.Header.Get("Client-Id") != "clientid" {
+			t.Errorf("unexpected auth headers: %v", r.Header)
+		}
+		return false
+	})
+
+	users, err := client.GetUsersByName("monkebot", "someone")
+	if err != nil {
+		t.Fatalf("failed to get users: %v", err)
+	}
+	if len(users) != 2 || users[0].ID != "id_monkebot" || users[1].ID != "id_someone" {
+		t.Errorf("unexpected users: %+v", users)
+	}
+
+	users, err = client.GetUsersByID("1")
+	if err != nil {
+		t.Fatalf("failed to get users: %v", err)
+	}
+	if len(users) != 1 || users[0].Login != "login_1" {
+		t.Errorf("unexpected users: %+v", users)
+	}
+}
+
+func TestGetUsersBatches(t *testing.T) {
+	var batchSizes []int
+	client := newFakeHelix(t, func(w http.ResponseWriter, r *http.Request) bool {
+		batchSizes = append(batchSizes, len(r.URL.Query()["login"]))
+		return false
+	})
+
+	names := make([]string, 250)
+	for i := range names {
+		names[i] = fmt.Sprintf("user%d", i)
+	}
+
+	users, err := client.GetUsersByName(names...)
+	if err != nil {
+		t.Fatalf("failed to get users: %v", err)
+	}
+	if len(users) != len(names) {
+		t.Errorf("expected %d users, got %d", len(names), len(users))
+	}
+	if fmt.Sprint(batchSizes) != "[100 100 50]" {
+		t.Errorf("expected batches of [100 100 50], got %v", batchSizes)
+	}
+}
+
+func TestGetUsersRetriesRateLimit(t *testing.T) {
+	requests, limitedRequests := 0, 2
+	client := newFakeHelix(t, func(w http.ResponseWriter, r *http.Request) bool {
+		requests++
+		if requests > limitedRequests {
+			return false
+		}
+		w.Header().Set("Ratelimit-Reset", strconv.FormatInt(time.Now().Unix(), 10))
+		w.WriteHeader(http.StatusTooManyRequests)
+		return true
+	})
+
+	users, err := client.GetUsersByName("monkebot")
+	if err != nil {
+		t.Fatalf("expected the request to succeed after retrying, got %v", err)
+	}
+	if len(users) != 1 || requests != 3 {
+		t.Errorf("expected 1 user after 3 requests, got %d users after %d requests", len(users), requests)
+	}
+
+	requests = 0
+	client.MaxRetries = 1
+	_, err = client.GetUsersByName("monkebot")
+	if !errors.Is(err, ErrRateLimited) {
+		t.Errorf("expected ErrRateLimited after running out of retries, got %v", err)
+	}
+	if requests != 2 {
+		t.Errorf("expected 2 requests, got %d", requests)
+	}
+}
+
+func TestGetUsersErrors(t *testing.T) {
+	tests := []struct {
+		status int
+		err    error
+	}{
+		{http.StatusUnauthorized, ErrUnauthorized},
+		{http.StatusNotFound, ErrNotFound},
+		{http.StatusInternalServerError, ErrServer},
+		{http.StatusServiceUnavailable, ErrServer},
+	}
+
+	for _, test := range tests {
+		client := newFakeHelix(t, func(w http.ResponseWriter, r *http.Request) bool {
+			w.WriteHeader(test.status)
+			fmt.Fprint(w, `{"error": "error", "status": 0, "message": "something went wrong"}`)
+			return true
+		})
+
+		_, err := client.GetUsersByName("monkebot")
+		if !errors.Is(err, test.err) {
+			t.Errorf("expected %v for status %d, got %v", test.err, test.status, err)
+		}
+
+		var helixErr *HelixError
+		if !errors.As(err, &helixErr) || helixErr.StatusCode != test.status || helixErr.Message != "something went wrong" {
+			t.Errorf("expected HelixError with status %d, got %v", test.status, err)
+		}
+	}
+}
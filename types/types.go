@@ -5,8 +5,8 @@ import (
 	"time"
 
 	"monkebot/config"
-
-	"github.com/gempir/go-twitch-irc/v4"
+	"monkebot/twitchapi"
+	"monkebot/users"
 )
 
 // Command is a struct defining a command.
@@ -16,6 +16,8 @@ import (
 // that if any of the ArgSpecs are matched, the Command will be executed.
 // The tags required(true/false) and argtype(positional/named) may be specified
 // for each field defined in an ArgSpec struct.
+// The matched ArgSpec is filled and passed to Execute in Message.Args, and the Usage is
+// sent instead of running the command if no ArgSpec matches.
 type Command struct {
 	Name            string
 	Aliases         []string
@@ -25,6 +27,13 @@ type Command struct {
 	UserCooldown    int
 	NoPrefix        bool
 	CanDisable      bool
+	// RequiredRole is checked before running the command, users without it are told which role they need
+	RequiredRole Role
+
+	// Subcommands are called with the command's name first, like "explore stats", and are handled like commands,
+	// with their own usage, cooldowns and ArgSpecs. Their name in the database is the full name, like "explore stats".
+	// The command itself runs when the next arg isn't a subcommand.
+	Subcommands []Command `json:",omitempty"`
 
 	// `json:"-"` excludes these fields from being serialized into the command list json
 	ArgSpecs          []interface{}                                                     `json:"-"`
@@ -32,6 +41,27 @@ type Command struct {
 	Execute           func(message *Message, sender MessageSender, args []string) error `json:"-"`
 }
 
+// Role is who can run a command, each role can also run the commands of the roles before it
+type Role string
+
+const (
+	RoleEveryone Role = "everyone"
+	RoleVIP      Role = "vip"
+	// given by the broadcaster with the role command, see ChannelRoles
+	RoleTrusted     Role = "trusted"
+	RoleMod         Role = "mod"
+	RoleEditor      Role = "editor"
+	RoleBroadcaster Role = "broadcaster"
+	// users with a global permission that has is_bot_admin, who can run every command
+	RoleBotAdmin Role = "bot-admin"
+)
+
+// Roles in order, from the least to the most privileged. Editors can run the same commands as mods.
+var Roles = []Role{RoleEveryone, RoleVIP, RoleTrusted, RoleMod, RoleEditor, RoleBroadcaster, RoleBotAdmin}
+
+// ChannelRoles are given to users in a single channel, so they don't need to be a mod or VIP there
+var ChannelRoles = []Role{RoleTrusted, RoleEditor}
+
 type SortByPrefixAndName []Command
 
 func (a SortByPrefixAndName) Len() int      { return len(a) }
@@ -62,25 +92,13 @@ type Message struct {
 	RoomID  string
 	Chatter Chatter
 	DB      *sql.DB
-}
+	Helix   *twitchapi.Client
+	Users   *users.Resolver
 
-func NewMessage(msg twitch.PrivateMessage, db *sql.DB, cfg *config.Config) *Message {
-	return &Message{
-		ID:      msg.ID,
-		Message: msg.Message,
-		Time:    msg.Time,
-		Channel: msg.Channel,
-		RoomID:  msg.RoomID,
-		Cfg:     cfg,
-		Chatter: Chatter{
-			Name:          msg.User.Name,
-			ID:            msg.User.ID,
-			IsMod:         msg.User.IsMod,
-			IsVIP:         msg.User.IsVip,
-			IsBroadcaster: msg.User.IsBroadcaster,
-		},
-		DB: db,
-	}
+	// Args is a filled copy of the command's matching ArgSpec, nil for commands without ArgSpecs
+	Args interface{}
+	// Prefix is the command prefix of the channel, its own or the default from Cfg
+	Prefix string
 }
 
 type SenderParam int
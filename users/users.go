@@ -0,0 +1,256 @@
+package users
+
+import (
+	"database/sql"
+	"fmt"
+	"monkebot/database"
+	"monkebot/twitchapi"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultTTL is how long resolved users, and the names of users seen in chat, are kept in memory
+const DefaultTTL = time.Hour
+
+// longest time between removing expired entries, sooner if the TTL is shorter
+const sweepInterval = time.Minute
+
+type User struct {
+	ID   string
+	Name string
+}
+
+type cachedUser struct {
+	user      User
+	expiresAt time.Time
+}
+
+type seenName struct {
+	name      string
+	expiresAt time.Time
+}
+
+// Resolver finds users by name, checking an in-memory cache and the user table first
+// and only asking Helix for the ones it doesn't know yet
+type Resolver struct {
+	TTL time.Duration
+
+	helix *twitchapi.Client
+	mu    sync.Mutex
+	cache map[string]cachedUser
+	// last name seen for each user id, so the database is only updated when it changes.
+	// Users that stop chatting expire like the cache, so it doesn't grow with every chatter ever seen.
+	names     map[string]seenName
+	lastSweep time.Time
+}
+
+func NewResolver(helix *twitchapi.Client, ttl time.Duration) *Resolver {
+	return &Resolver{
+		TTL:   ttl,
+		helix: helix,
+		cache: make(map[string]cachedUser),
+		names: make(map[string]seenName),
+	}
+}
+
+// ResolveNames returns the users with the given names, in the same order, leaving out names that don't exist on Twitch.
+// Users found on Helix are inserted in the user table with tx, so they're known the next time.
+// Only users read from the database are cached, so the cache never has users the caller didn't commit.
+func (r *Resolver) ResolveNames(tx *sql.Tx, names ...string) ([]User, error) {
+	names = normalizeNames(names)
+	found := make(map[string]User, len(names))
+
+	var misses []string
+	r.mu.Lock()
+	now := time.Now()
+	for _, name := range names {
+		cached, ok := r.cache[name]
+		if ok && now.Before(cached.expiresAt) {
+			found[name] = cached.user
+			continue
+		}
+		delete(r.cache, name)
+		misses = append(misses, name)
+	}
+	r.mu.Unlock()
+
+	if len(misses) > 0 {
+		dbUsers, err := database.SelectUsersByName(tx, misses...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up users in the database: %w", err)
+		}
+		for _, dbUser := range dbUsers {
+			found[dbUser.Name] = User{ID: dbUser.ID, Name: dbUser.Name}
+			r.store(User{ID: dbUser.ID, Name: dbUser.Name})
+		}
+	}
+
+	var helixMisses []string
+	for _, name := range misses {
+		if _, ok := found[name]; !ok {
+			helixMisses = append(helixMisses, name)
+		}
+	}
+
+	if len(helixMisses) > 0 {
+		log.Debug().Strs("names", helixMisses).Msg("resolving unknown users with helix")
+		helixUsers, err := r.helix.GetUsersByName(helixMisses...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve users with helix: %w", err)
+		}
+
+		newUsers := make([]struct{ ID, Name string }, 0, len(helixUsers))
+		for _, helixUser := range helixUsers {
+			user := User{ID: helixUser.ID, Name: helixUser.Login}
+			found[user.Name] = user
+			newUsers = append(newUsers, struct{ ID, Name string }{user.ID, user.Name})
+		}
+
+		err = database.InsertUsers(tx, false, newUsers...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to save resolved users: %w", err)
+		}
+
+		// users that were already saved with an old name were skipped by InsertUsers
+		for _, user := range newUsers {
+			_, err = database.UpdateUserName(tx, user.ID, user.Name)
+			if err != nil {
+				return nil, fmt.Errorf("failed to update resolved user's name: %w", err)
+			}
+		}
+
+		// not cached, the caller's transaction can still roll back the insert. They're cached when they're
+		// found in the database the next time.
+	}
+
+	users := make([]User, 0, len(names))
+	for _, name := range names {
+		if user, ok := found[name]; ok {
+			users = append(users, user)
+		}
+	}
+
+	return users, nil
+}
+
+// RecordNames saves the names of users seen in chat, so renamed users are updated in the database.
+// Users that aren't in the database are ignored.
+func (r *Resolver) RecordNames(db *sql.DB, seen ...User) error {
+	var changed []User
+	r.mu.Lock()
+	now := time.Now()
+	r.sweep(now)
+	for _, user := range seen {
+		if user.ID == "" {
+			continue
+		}
+		if last, ok := r.names[user.ID]; ok && last.name == user.Name && now.Before(last.expiresAt) {
+			r.names[user.ID] = seenName{name: user.Name, expiresAt: now.Add(r.TTL)}
+			continue
+		}
+		changed = append(changed, user)
+	}
+	r.mu.Unlock()
+
+	if len(changed) == 0 {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var renamed []User
+	for _, user := range changed {
+		var wasRenamed bool
+		wasRenamed, err = database.UpdateUserName(tx, user.ID, user.Name)
+		if err != nil {
+			return err
+		}
+		if wasRenamed {
+			renamed = append(renamed, user)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("failed to commit user names: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	expiresAt := time.Now().Add(r.TTL)
+	for _, user := range changed {
+		r.names[user.ID] = seenName{name: user.Name, expiresAt: expiresAt}
+	}
+	// the old names may belong to someone else now
+	for name, cached := range r.cache {
+		for _, user := range renamed {
+			if cached.user.ID == user.ID && name != user.Name {
+				delete(r.cache, name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Forget removes a user from the cache, for users whose data was deleted
+func (r *Resolver) Forget(userID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.names, userID)
+	for name, cached := range r.cache {
+		if cached.user.ID == userID {
+			delete(r.cache, name)
+		}
+	}
+}
+
+// Removes the cached users and names that expired, at most once per sweepInterval or TTL, so names that are never
+// looked up again don't stay in memory. Must be called with r.mu held.
+func (r *Resolver) sweep(now time.Time) {
+	if now.Sub(r.lastSweep) < min(r.TTL, sweepInterval) {
+		return
+	}
+	r.lastSweep = now
+
+	for name, cached := range r.cache {
+		if !now.Before(cached.expiresAt) {
+			delete(r.cache, name)
+		}
+	}
+	for id, seen := range r.names {
+		if !now.Before(seen.expiresAt) {
+			delete(r.names, id)
+		}
+	}
+}
+
+func (r *Resolver) store(user User) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	r.sweep(now)
+	r.cache[user.Name] = cachedUser{user: user, expiresAt: now.Add(r.TTL)}
+}
+
+// Twitch logins are lowercase, and users are often mentioned as @name
+func normalizeNames(names []string) []string {
+	normalized := make([]string, 0, len(names))
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimPrefix(name, "@"))
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		normalized = append(normalized, name)
+	}
+	return normalized
+}
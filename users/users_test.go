@@ -0,0 +1,243 @@
+package users
+
+import (
+	"database/sql"
+	"encoding/json"
+	"monkebot/database"
+	"monkebot/twitchapi"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestDB(t *testing.T) *sql.DB {
+	db, err := database.InitDB("sqlite3", "file:"+filepath.Join(t.TempDir(), "test.db"), 0)
+	if err != nil {
+		t.Fatalf("failed to init database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// fake Helix server that knows users named "user<id>", and fails when down is true
+func newTestHelix(t *testing.T, requestedNames *[]string, down *bool) *twitchapi.Client {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if *down {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		var response struct {
+			Data []twitchapi.HelixUser `json:"data"`
+		}
+		for _, login := range r.URL.Query()["login"] {
+			*requestedNames = append(*requestedNames, login)
+			if login == "unknown" {
+				continue
+			}
+			response.Data = append(response.Data, twitchapi.HelixUser{ID: "id_" + login, Login: login})
+		}
+		json.NewEncoder(w).Encode(response)
+	}))
+	t.Cleanup(server.Close)
+
+	helix := twitchapi.NewClient("clientid", twitchapi.StaticToken("token"))
+	helix.BaseURL = server.URL
+	helix.HTTPClient = server.Client()
+	helix.MaxRetries = 0
+	return helix
+}
+
+func resolve(t *testing.T, db *sql.DB, r *Resolver, names ...string) []User {
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	users, err := r.ResolveNames(tx, names...)
+	if err != nil {
+		t.Fatalf("failed to resolve %v: %v", names, err)
+	}
+	if err = tx.Commit(); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+	return users
+}
+
+func TestResolveNames(t *testing.T) {
+	db := newTestDB(t)
+	var requested []string
+	down := false
+	r := NewResolver(newTestHelix(t, &requested, &down), time.Hour)
+
+	users := resolve(t, db, r, "@Alice", "bob", "unknown", "alice")
+	if len(users) != 2 || users[0] != (User{"id_alice", "alice"}) || users[1] != (User{"id_bob", "bob"}) {
+		t.Errorf("unexpected users: %+v", users)
+	}
+	if len(requested) != 3 {
+		t.Errorf("expected alice, bob and unknown to be requested from helix once, got %v", requested)
+	}
+
+	// found in the database, and cached from there
+	requested = nil
+	resolve(t, db, r, "alice", "bob")
+	if len(requested) != 0 {
+		t.Errorf("expected saved users not to be requested, got %v", requested)
+	}
+	if _, ok := r.cache["alice"]; !ok {
+		t.Error("expected alice to be cached after being found in the database")
+	}
+
+	// a new resolver has an empty cache, but the users were saved in the database, so it works while helix is down
+	down = true
+	r = NewResolver(r.helix, time.Hour)
+	users = resolve(t, db, r, "alice", "bob")
+	if len(users) != 2 || len(requested) != 0 {
+		t.Errorf("expected users from the database without helix requests, got %+v and requested %v", users, requested)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+	_, err = r.ResolveNames(tx, "alice", "carol")
+	if err == nil {
+		t.Error("expected an error resolving an unknown user while helix is down")
+	}
+}
+
+func TestResolveNamesRollback(t *testing.T) {
+	db := newTestDB(t)
+	var requested []string
+	down := false
+	r := NewResolver(newTestHelix(t, &requested, &down), time.Hour)
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("failed to begin transaction: %v", err)
+	}
+	users, err := r.ResolveNames(tx, "alice")
+	if err != nil || len(users) != 1 {
+		t.Fatalf("failed to resolve alice: %+v, %v", users, err)
+	}
+	tx.Rollback()
+
+	// alice isn't in the database, so it can't be cached either
+	if _, ok := r.cache["alice"]; ok {
+		t.Error("expected alice not to be cached after the rollback")
+	}
+	users = resolve(t, db, r, "alice")
+	if len(users) != 1 || len(requested) != 2 {
+		t.Errorf("expected alice to be requested from helix again, got %+v and requested %v", users, requested)
+	}
+}
+
+func TestResolveNamesTTL(t *testing.T) {
+	db := newTestDB(t)
+	var requested []string
+	down := false
+	r := NewResolver(newTestHelix(t, &requested, &down), time.Hour)
+
+	// the second time alice is found in the database and cached
+	resolve(t, db, r, "alice")
+	resolve(t, db, r, "alice")
+	r.TTL = 0
+	resolve(t, db, r, "dave")
+
+	// dave expired immediately, so dave is looked up again, but found in the database instead of helix
+	users := resolve(t, db, r, "dave")
+	if len(users) != 1 || users[0].ID != "id_dave" {
+		t.Errorf("expected dave from the database, got %+v", users)
+	}
+	if len(requested) != 2 {
+		t.Errorf("expected only alice and dave to be requested from helix, got %v", requested)
+	}
+	if !time.Now().Before(r.cache["alice"].expiresAt) {
+		t.Error("expected alice to still be cached")
+	}
+}
+
+func TestResolveNamesSweep(t *testing.T) {
+	db := newTestDB(t)
+	var requested []string
+	down := false
+	// users expire right away
+	r := NewResolver(newTestHelix(t, &requested, &down), 0)
+
+	// the second time users are found in the database and cached
+	resolve(t, db, r, "alice")
+	resolve(t, db, r, "alice")
+	if _, ok := r.cache["alice"]; !ok {
+		t.Fatal("expected alice to be cached")
+	}
+
+	// alice is never looked up again, but is removed when another user is cached
+	resolve(t, db, r, "bob")
+	resolve(t, db, r, "bob")
+	if _, ok := r.cache["alice"]; ok || len(r.cache) != 1 {
+		t.Errorf("expected only bob to be cached, got %v", r.cache)
+	}
+}
+
+func TestRecordNames(t *testing.T) {
+	db := newTestDB(t)
+	var requested []string
+	down := false
+	r := NewResolver(newTestHelix(t, &requested, &down), time.Hour)
+
+	// the second time alice is found in the database and cached
+	resolve(t, db, r, "alice")
+	resolve(t, db, r, "alice")
+	err := r.RecordNames(db, User{ID: "id_alice", Name: "alice2"}, User{ID: "id_unknown", Name: "unknown"})
+	if err != nil {
+		t.Fatalf("failed to record names: %v", err)
+	}
+
+	if _, ok := r.cache["alice"]; ok {
+		t.Error("expected the old name to be removed from the cache")
+	}
+
+	down = true
+	users := resolve(t, db, r, "alice2")
+	if len(users) != 1 || users[0].ID != "id_alice" {
+		t.Errorf("expected alice2 to be found in the database by the new name, got %+v", users)
+	}
+
+	var history int
+	err = db.QueryRow("SELECT COUNT(*) FROM user_name_history WHERE user_id = 'id_alice' AND old_name = 'alice' AND new_name = 'alice2'").Scan(&history)
+	if err != nil {
+		t.Fatalf("failed to select name history: %v", err)
+	}
+	if history != 1 {
+		t.Errorf("expected the rename to be saved in the name history, got %d rows", history)
+	}
+}
+
+func TestRecordNamesExpire(t *testing.T) {
+	db := newTestDB(t)
+	var requested []string
+	down := false
+	// names expire right away
+	r := NewResolver(newTestHelix(t, &requested, &down), 0)
+
+	err := r.RecordNames(db, User{ID: "id_alice", Name: "alice"})
+	if err != nil {
+		t.Fatalf("failed to record names: %v", err)
+	}
+	if _, ok := r.names["id_alice"]; !ok {
+		t.Fatal("expected alice's name to be recorded")
+	}
+
+	// alice stopped chatting, so alice's id is removed the next time names are recorded
+	err = r.RecordNames(db, User{ID: "id_bob", Name: "bob"})
+	if err != nil {
+		t.Fatalf("failed to record names: %v", err)
+	}
+	if _, ok := r.names["id_alice"]; ok || len(r.names) != 1 {
+		t.Errorf("expected only bob's name to be kept, got %v", r.names)
+	}
+}